@@ -1,22 +1,19 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
 
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
 	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/microsoft"
+	"golang.org/x/oauth2/twitch"
 )
 
-const defaultGoogleOAuthStateStr string = "5dYo3mAPGIp8OxZepJgs62YKoz0SDjatFhBVgw5JEg7KvucAjh8qkPovuBteJhPF"
-
-func googleOAuthStateStr() string {
-	ss := os.Getenv(EnvGoogleOAuthStateStr)
-	if ss == "" {
-		return defaultGoogleOAuthStateStr
-	}
-	return ss
-}
+const defaultMicrosoftTenant string = "common"
 
 func GoogleConfig() *oauth2.Config {
 	return &oauth2.Config{
@@ -27,3 +24,163 @@ func GoogleConfig() *oauth2.Config {
 		Endpoint:     google.Endpoint,
 	}
 }
+
+var discordEndpoint = oauth2.Endpoint{
+	AuthURL:   "https://discord.com/oauth2/authorize",
+	TokenURL:  "https://discord.com/api/oauth2/token",
+	AuthStyle: oauth2.AuthStyleInParams,
+}
+
+func DiscordConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     os.Getenv(EnvDiscordClientID),
+		ClientSecret: os.Getenv(EnvDiscordClientSecret),
+		RedirectURL:  fmt.Sprintf("%s//%s/callback/discord", os.Getenv(EnvProtocol), os.Getenv(EnvHostname)),
+		Scopes:       []string{DiscordOauthScopeEmail, DiscordOauthScopeIdentify},
+		Endpoint:     discordEndpoint,
+	}
+}
+
+func GitHubConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     os.Getenv(EnvGitHubClientID),
+		ClientSecret: os.Getenv(EnvGitHubClientSecret),
+		RedirectURL:  fmt.Sprintf("%s//%s/callback/github", os.Getenv(EnvProtocol), os.Getenv(EnvHostname)),
+		Scopes:       []string{GitHubOauthScopeReadUser, GitHubOauthScopeUserEmail},
+		Endpoint:     github.Endpoint,
+	}
+}
+
+// microsoftTenant is either "common", "organizations", "consumers" or a specific tenant ID
+func microsoftTenant() string {
+	return fallbackIfEmpty(os.Getenv(EnvMicrosoftTenant), defaultMicrosoftTenant)
+}
+
+func MicrosoftConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     os.Getenv(EnvMicrosoftClientID),
+		ClientSecret: os.Getenv(EnvMicrosoftClientSecret),
+		RedirectURL:  fmt.Sprintf("%s//%s/callback/microsoft", os.Getenv(EnvProtocol), os.Getenv(EnvHostname)),
+		Scopes:       []string{OIDCScopeOpenID, OIDCScopeEmail, OIDCScopeProfile, MicrosoftOauthScopeUserRead},
+		Endpoint:     microsoft.AzureADEndpoint(microsoftTenant()),
+	}
+}
+
+var redditEndpoint = oauth2.Endpoint{
+	AuthURL:   "https://www.reddit.com/api/v1/authorize",
+	TokenURL:  "https://www.reddit.com/api/v1/access_token",
+	AuthStyle: oauth2.AuthStyleInHeader,
+}
+
+func RedditConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     os.Getenv(EnvRedditClientID),
+		ClientSecret: os.Getenv(EnvRedditClientSecret),
+		RedirectURL:  fmt.Sprintf("%s//%s/callback/reddit", os.Getenv(EnvProtocol), os.Getenv(EnvHostname)),
+		Scopes:       []string{RedditOauthScopeIdentity},
+		Endpoint:     redditEndpoint,
+	}
+}
+
+func TwitchConfig() *oauth2.Config {
+	endpoint := twitch.Endpoint
+	endpoint.AuthStyle = oauth2.AuthStyleInParams
+
+	return &oauth2.Config{
+		ClientID:     os.Getenv(EnvTwitchClientID),
+		ClientSecret: os.Getenv(EnvTwitchClientSecret),
+		RedirectURL:  fmt.Sprintf("%s//%s/callback/twitch", os.Getenv(EnvProtocol), os.Getenv(EnvHostname)),
+		Scopes:       []string{TwitchOauthScopeUserReadEmail},
+		Endpoint:     endpoint,
+	}
+}
+
+const (
+	defaultGenericProviderEmailPath         = "email"
+	defaultGenericProviderEmailVerifiedPath = "email_verified"
+	defaultGenericProviderNamePath          = "name"
+)
+
+var genericProviderNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// LoadGenericProviderConfigs reads the generic OAuth providers from the OAUTH_PROVIDERS
+// env var (a JSON array), or from the JSON file at OAUTH_PROVIDERS_FILE.
+func LoadGenericProviderConfigs() (map[ProviderName]GenericProviderConfig, error) {
+	configs := make(map[ProviderName]GenericProviderConfig)
+
+	b := []byte(os.Getenv(EnvOAuthProviders))
+	if len(b) == 0 {
+		filePath := os.Getenv(EnvOAuthProvidersFile)
+		if filePath == "" {
+			return configs, nil
+		}
+
+		fb, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		b = fb
+	}
+
+	var cfgs []GenericProviderConfig
+	if err := json.Unmarshal(b, &cfgs); err != nil {
+		return nil, fmt.Errorf("invalid generic OAuth provider config: %w", err)
+	}
+
+	// Names that only differ in case share the same routes, so they count as duplicates
+	slugs := make(map[string]ProviderName)
+	for _, cfg := range cfgs {
+		cfg = cfg.withDefaults()
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		if name, ok := slugs[providerSlug(cfg.Name)]; ok {
+			return nil, fmt.Errorf("duplicate generic OAuth provider %s, which conflicts with %s", cfg.Name, name)
+		}
+		slugs[providerSlug(cfg.Name)] = cfg.Name
+		configs[cfg.Name] = cfg
+	}
+
+	return configs, nil
+}
+
+func (cfg GenericProviderConfig) withDefaults() GenericProviderConfig {
+	if cfg.EmailPath == "" {
+		cfg.EmailPath = defaultGenericProviderEmailPath
+	}
+	if cfg.NamePath == "" {
+		cfg.NamePath = defaultGenericProviderNamePath
+	}
+	if cfg.EmailVerifiedPath == "" {
+		cfg.EmailVerifiedPath = defaultGenericProviderEmailVerifiedPath
+	}
+	if len(cfg.Scopes) == 0 && cfg.Issuer != "" {
+		cfg.Scopes = []string{OIDCScopeOpenID, OIDCScopeEmail, OIDCScopeProfile}
+	}
+	return cfg
+}
+
+func (cfg GenericProviderConfig) Validate() error {
+	if !genericProviderNameRegexp.MatchString(string(cfg.Name)) {
+		return fmt.Errorf("invalid generic OAuth provider name %q", cfg.Name)
+	}
+	if _, err := ToBuiltInProviderName(string(cfg.Name)); err == nil {
+		return fmt.Errorf("generic OAuth provider %s conflicts with a built-in provider", cfg.Name)
+	}
+	for _, pn := range providerNames {
+		if providerSlug(pn) == providerSlug(cfg.Name) {
+			return fmt.Errorf("generic OAuth provider %s conflicts with a built-in provider", cfg.Name)
+		}
+	}
+	if cfg.ClientID == "" {
+		return fmt.Errorf("generic OAuth provider %s is missing a client ID", cfg.Name)
+	}
+	if cfg.Issuer == "" && (cfg.AuthURL == "" || cfg.TokenURL == "" || cfg.UserInfoURL == "") {
+		return fmt.Errorf("generic OAuth provider %s needs either an issuer or auth, token and userinfo URLs", cfg.Name)
+	}
+	return nil
+}
+
+func (cfg GenericProviderConfig) RedirectURL() string {
+	return fmt.Sprintf("%s//%s/callback/%s", os.Getenv(EnvProtocol), os.Getenv(EnvHostname), providerSlug(cfg.Name))
+}
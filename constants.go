@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 const cookieMaxAge = 0
 
 const (
@@ -15,6 +17,36 @@ const (
 
 const jwtExpiry = 15000
 
+const (
+	oauthStateMaxAge   = 15 * time.Minute
+	oauthStateNumBytes = 32
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// Number of subscribers read per query when exporting an email list, and sent
+// per response when running on Lambda
+const exportChunkSize = maxPageLimit
+
+const (
+	importBatchSize = 500
+	maxImportBytes  = 32 << 20
+)
+
+// Column sizes of the subscribers table
+const (
+	maxEmailAddrLength          = 150
+	maxSubscriberNameLength     = 100
+	maxSourceProviderNameLength = 50
+	maxProviderSubjectIDLength  = 255
+	maxGivenNameLength          = 100
+	maxFamilyNameLength         = 100
+	maxLocaleLength             = 20
+)
+
 const minDelimLength = 6
 
 const (
@@ -22,4 +54,37 @@ const (
 	maxPasswordLength = 20
 )
 
+const (
+	outboxBatchSize       = 25
+	outboxMaxAttempts     = 8
+	outboxBaseBackoff     = 30 * time.Second
+	outboxMaxBackoff      = 6 * time.Hour
+	outboxPollInterval    = 15 * time.Second
+	outboxProcessingStale = 10 * time.Minute
+)
+
+// Limits that Discord and Slack place on webhook messages
+const (
+	discordMaxContentLength = 2000
+	discordMaxEmbeds        = 10
+	slackMaxBlocks          = 50
+)
+
+// Most of a response body that is read just so the connection can be reused
+const maxDrainBytes = 64 << 10
+
+// Timeout of requests that outputs make to third-party APIs and webhooks
+const outputRequestTimeout = 10 * time.Second
+
+// Timeout of fetching an issuer's OIDC discovery document, which blocks the visitor's login
+const oidcDiscoveryTimeout = 10 * time.Second
+
+// Minimum time between deliveries to the same output, so that third-party rate limits
+// are respected when many jobs for one output are due at once, such as after a replay
+const outboxOutputInterval = 200 * time.Millisecond
+
+// How long a POST to /outbox/dispatch keeps claiming jobs, which leaves time for the
+// last batch to finish before API Gateway's 29 second timeout when running on Lambda
+const outboxDispatchBudget = 20 * time.Second
+
 const rootUserID = "-1"
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Keeps the credentials key distinct from anything else derived from CRYPTO_SECRET
+const credentialKeyInfo = "oauth-email-lists output credentials"
+
+// CredentialCipher encrypts the credentials of outputs at rest with AES-256-GCM
+type CredentialCipher struct {
+	aead cipher.AEAD
+}
+
+func NewCredentialCipher(secret string) (*CredentialCipher, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, []byte(credentialKeyInfo)), key); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CredentialCipher{aead: aead}, nil
+}
+
+// Seal encrypts the plaintext, binding it to the output ID so that
+// the ciphertext can't be copied onto another output and decrypted there
+func (c *CredentialCipher) Seal(outputID string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, []byte(outputID)), nil
+}
+
+func (c *CredentialCipher) Open(outputID string, sealed []byte) ([]byte, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, fmt.Errorf("credentials of output %s are malformed", outputID)
+	}
+	plaintext, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(outputID))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting credentials of output %s: %w", outputID, err)
+	}
+	return plaintext, nil
+}
+
+// outputCredentialFields returns the config fields of the output name that are write-only
+func outputCredentialFields(outputName OutputName) []string {
+	schema, ok := outputConfigSchemas[outputName]
+	if !ok {
+		return nil
+	}
+
+	fields := []string{}
+	for name, property := range schema.Properties {
+		if property.WriteOnly {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// allOutputCredentialFields is every write-only config field, across all output names
+func allOutputCredentialFields() []string {
+	fields := []string{}
+	for outputName := range outputConfigSchemas {
+		for _, field := range outputCredentialFields(outputName) {
+			if !slices.Contains(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// splitOutputCredentials moves the write-only fields of the config into credentials,
+// which is nil if the config has none of them
+func splitOutputCredentials(outputName OutputName, config json.RawMessage) (json.RawMessage, json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &fields); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	credentials := map[string]json.RawMessage{}
+	for _, name := range outputCredentialFields(outputName) {
+		if value, ok := fields[name]; ok {
+			credentials[name] = value
+			delete(fields, name)
+		}
+	}
+
+	public, err := json.Marshal(fields)
+	if err != nil || len(credentials) == 0 {
+		return public, nil, err
+	}
+	b, err := json.Marshal(credentials)
+	return public, b, err
+}
+
+// sealOutputConfig splits the credentials out of the config and encrypts them
+func sealOutputConfig(outputID string, outputName OutputName, config json.RawMessage) (json.RawMessage, []byte, error) {
+	public, credentials, err := splitOutputCredentials(outputName, config)
+	if err != nil || credentials == nil {
+		return public, nil, err
+	}
+	sealed, err := credentialCipher.Seal(outputID, credentials)
+	return public, sealed, err
+}
+
+// openOutputConfig decrypts the credentials, and merges them back into the config
+func openOutputConfig(outputID string, config json.RawMessage, sealed []byte) (json.RawMessage, error) {
+	if len(sealed) == 0 {
+		return config, nil
+	}
+	credentials, err := credentialCipher.Open(outputID, sealed)
+	if err != nil {
+		return nil, err
+	}
+	return mergeOutputConfig(config, credentials)
+}
+
+// marshalOutput is the JSON of an output without its credentials, which must never be
+// returned by the API. v should be the output converted to a type without a MarshalJSON method.
+func marshalOutput(outputName OutputName, v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range outputCredentialFields(outputName) {
+		delete(fields, name)
+	}
+
+	return json.Marshal(fields)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialCipher(t *testing.T) {
+	cc, err := NewCredentialCipher("123456789_123456789_123456789_12")
+	assert.Nil(t, err)
+
+	sealed, err := cc.Seal("output-1", []byte(`{"apiKey":"xkeysib-123"}`))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(sealed), "xkeysib-123")
+
+	plaintext, err := cc.Open("output-1", sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"apiKey":"xkeysib-123"}`, string(plaintext))
+
+	// Credentials are bound to the output they were sealed for
+	_, err = cc.Open("output-2", sealed)
+	assert.NotNil(t, err)
+
+	other, err := NewCredentialCipher("987654321_987654321_987654321_98")
+	assert.Nil(t, err)
+	_, err = other.Open("output-1", sealed)
+	assert.NotNil(t, err)
+
+	_, err = cc.Open("output-1", []byte("short"))
+	assert.NotNil(t, err)
+}
+
+func TestSplitOutputCredentials(t *testing.T) {
+	public, credentials, err := splitOutputCredentials(
+		OutputNameWebhook,
+		json.RawMessage(`{"urlFmt": "https://example.com", "secret": "whsec_0123456789abcdef"}`),
+	)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"urlFmt": "https://example.com"}`, string(public))
+	assert.JSONEq(t, `{"secret": "whsec_0123456789abcdef"}`, string(credentials))
+
+	_, credentials, err = splitOutputCredentials(OutputNameWebhook, json.RawMessage(`{"urlFmt": "https://example.com"}`))
+	assert.Nil(t, err)
+	assert.Nil(t, credentials)
+
+	assert.Equal(t, []string{"apiKey"}, outputCredentialFields(OutputNameBrevo))
+	assert.Empty(t, outputCredentialFields(OutputNameAWeber))
+	assert.Equal(t, []string{"headers", "secret"}, outputCredentialFields(OutputNameWebhook))
+	assert.Equal(t, []string{"apiKey", "botId", "headers", "secret", "webhookUrl"}, allOutputCredentialFields())
+}
+
+func TestMarshalOutputOmitsCredentials(t *testing.T) {
+	outputs := []Output{
+		BrevoOutput{ID: "1", BrevoOutputConfig: BrevoOutputConfig{ListID: "2", ApiKey: "xkeysib-123"}},
+		TelegramOutput{ID: "1", TelegramOutputConfig: TelegramOutputConfig{ChatID: "-100123", MsgFmt: "hi", BotID: "bot123"}},
+		WebhookOutput{ID: "1", WebhookOutputConfig: WebhookOutputConfig{UrlFmt: "https://example.com", Secret: "whsec_0123456789abcdef"}},
+	}
+
+	b, err := json.Marshal(makeOutputsData(outputs))
+	assert.Nil(t, err)
+	for _, secret := range []string{"xkeysib-123", "bot123", "whsec_0123456789abcdef"} {
+		assert.NotContains(t, string(b), secret)
+	}
+	assert.Contains(t, string(b), `"listId":"2"`)
+	assert.Contains(t, string(b), `"chatId":"-100123"`)
+	assert.Contains(t, string(b), `"urlFmt":"https://example.com"`)
+}
+
+func TestMarshalOutputOmitsWebhookHeaders(t *testing.T) {
+	wo := WebhookOutput{ID: "1", WebhookOutputConfig: WebhookOutputConfig{
+		UrlFmt:  "https://example.com",
+		Headers: map[string]string{HTTPHeaderAuthorization: "Bearer secret-token"},
+	}}
+
+	b, err := json.Marshal(wo)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(b), "secret-token")
+	assert.NotContains(t, string(b), HTTPHeaderAuthorization)
+
+	public, credentials, err := splitOutputCredentials(
+		OutputNameWebhook,
+		json.RawMessage(`{"urlFmt": "https://example.com", "headers": {"Authorization": "Bearer secret-token"}}`),
+	)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(public), "secret-token")
+	assert.Contains(t, string(credentials), "secret-token")
+}
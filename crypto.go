@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"net/url"
 	"strings"
@@ -152,3 +154,12 @@ func validDelim(delim string) bool {
 func NewUUID() string {
 	return uuid.NewString()
 }
+
+// newOAuthStateStr returns an unguessable value for the OAuth state parameter
+func newOAuthStateStr() (string, error) {
+	b := make([]byte, oauthStateNumBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
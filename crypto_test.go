@@ -1,6 +1,7 @@
 package main
 
 import (
+	"net/url"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -135,3 +136,14 @@ func testingUrls() []string {
 		"https://subdoamin.bing.com/1/2/3?one=1&hello=true",
 	}
 }
+
+func TestOAuthStateStr(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		state, err := newOAuthStateStr()
+		assert.Nil(t, err)
+		assert.Equal(t, url.QueryEscape(state), state)
+		assert.False(t, seen[state])
+		seen[state] = true
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// Deliver runs the subscriber through the output and records the attempt
+// in the delivery log. outboxJobID is empty for deliveries made outside of the outbox.
+func Deliver(output Output, subscriber Subscriber, outboxJobID string) error {
+	start := time.Now()
+	statusCode, err := output.Handle(subscriber)
+
+	recordDelivery(NewDelivery(outboxJobID, output.GetID(), output.GetUserID(), subscriber.ID, statusCode, time.Since(start), err))
+	return err
+}
+
+// recordDelivery saves the delivery, only logging a failure so that
+// it doesn't hide the outcome of the delivery itself
+func recordDelivery(delivery *Delivery) {
+	if err := storage.InsertNewDelivery(delivery); err != nil {
+		log.Print(err)
+	}
+}
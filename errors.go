@@ -1,8 +1,14 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+
+	"github.com/lib/pq"
+	"golang.org/x/oauth2"
 )
 
 func unauthorized() error {
@@ -17,10 +23,112 @@ func outputIDNotProvided() error {
 	return fmt.Errorf("output ID not provided")
 }
 
+func emailListIDNotProvided() error {
+	return fmt.Errorf("email list ID not provided")
+}
+
+func jobIDNotProvided() error {
+	return fmt.Errorf("job ID not provided")
+}
+
+func emailAddrNotProvided() error {
+	return fmt.Errorf("email address not provided")
+}
+
+func subscriberIDNotProvided() error {
+	return fmt.Errorf("subscriber ID not provided")
+}
+
+func invalidOAuthState() error {
+	return fmt.Errorf("invalid oauth state")
+}
+
+func invalidUnverifiedEmailPolicy(policy UnverifiedEmailPolicy) error {
+	return fmt.Errorf("invalid unverified email policy: %s", policy)
+}
+
+func invalidEmailListDeleteMode(mode EmailListDeleteMode) error {
+	return fmt.Errorf("invalid email list delete mode: %s", mode)
+}
+
+func unknownOutputName(outputName OutputName) error {
+	return fmt.Errorf("unknown output name: %s", outputName)
+}
+
+func outputDeleted(outputID string) error {
+	return fmt.Errorf("output %s was deleted", outputID)
+}
+
+// notFoundError is a lookup that matched no rows. It counts as sql.ErrNoRows,
+// so that handlers can tell it apart from a failing query.
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+func (e notFoundError) Is(target error) bool {
+	return target == sql.ErrNoRows
+}
+
+func outboxJobNotFound(jobID string) error {
+	return notFoundError(fmt.Sprintf("outbox job %s not found", jobID))
+}
+
+func outboxJobAlreadyActive(outputID string) error {
+	return fmt.Errorf("a delivery to output %s is already pending", outputID)
+}
+
+func outboxJobNotRetryable(jobID string, status OutboxJobStatus) error {
+	return fmt.Errorf("outbox job %s is %s, and only dead or pending jobs can be retried", jobID, status)
+}
+
+func invalidFileFormat(format FileFormat) error {
+	return fmt.Errorf("invalid file format: %s", format)
+}
+
+func invalidEmailAddr(emailAddr string) error {
+	return fmt.Errorf("invalid email address: %s", emailAddr)
+}
+
+func missingImportEmailColumn() error {
+	return fmt.Errorf("import file has no email column")
+}
+
+func fieldTooLong(field string, maxLength int) error {
+	return fmt.Errorf("%s is longer than %d characters", field, maxLength)
+}
+
 func invalidOauthID() error {
 	return fmt.Errorf("invalid oauthID")
 }
 
+func emailAddrAlreadySubscribed(emailAddr string) error {
+	return fmt.Errorf("%s is already on this email list", emailAddr)
+}
+
+// The SQLSTATE postgres returns when an insert or update breaks a unique index
+const pqErrCodeUniqueViolation pq.ErrorCode = "23505"
+
+// isUniqueViolation reports whether a query failed because it would have broken a unique index
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqErrCodeUniqueViolation
+}
+
+func missingEmailAddr(providerName ProviderName) error {
+	return fmt.Errorf("%s did not return an email address", providerName)
+}
+
+// noVerifiedEmailAddr is for providers whose APIs never share a verified email address
+func noVerifiedEmailAddr(providerName ProviderName) error {
+	return fmt.Errorf("%s does not share a verified email address, so the visitor can't be added to an email list", providerName)
+}
+
+func unverifiedEmailAddr(providerName ProviderName) error {
+	return fmt.Errorf("%s email address is not verified", providerName)
+}
+
 func missingEnv(envVars ...string) error {
 	if len(envVars) == 0 {
 		return fmt.Errorf("unknown missingEnv error")
@@ -30,3 +138,94 @@ func missingEnv(envVars ...string) error {
 	}
 	return fmt.Errorf("missing required environment variables: %s", strings.Join(envVars, ", "))
 }
+
+func missingCredential(field string, envVar string) error {
+	return fmt.Errorf("config.%s is not set, and neither is the %s environment variable", field, envVar)
+}
+
+// OutputConfigError is returned when the config of an output does not match its schema
+type OutputConfigError struct {
+	OutputName OutputName
+	Err        error
+}
+
+func (e *OutputConfigError) Error() string {
+	return fmt.Sprintf("invalid %s output: %s", e.OutputName, e.Err)
+}
+
+func (e *OutputConfigError) Unwrap() error {
+	return e.Err
+}
+
+// outputErrorStatus is a bad request when the output's name or config was invalid
+func outputErrorStatus(err error) int {
+	var ce *OutputConfigError
+	if errors.As(err, &ce) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// StatusCodeError is returned when a third-party API responds with an unexpected status code,
+// so that callers can record the code alongside the error text.
+type StatusCodeError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *StatusCodeError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("received %d status code", e.StatusCode)
+}
+
+func (e *StatusCodeError) Unwrap() error {
+	return e.Err
+}
+
+func statusCodeOf(err error) int {
+	var sce *StatusCodeError
+	if errors.As(err, &sce) {
+		return sce.StatusCode
+	}
+	var re *oauth2.RetrieveError
+	if errors.As(err, &re) && re.Response != nil {
+		return re.Response.StatusCode
+	}
+	return 0
+}
+
+// ProviderError records which stage of the OAuth flow failed for a provider,
+// so the failure can be stored against the campaign it came from.
+type ProviderError struct {
+	ProviderName ProviderName
+	Stage        ProviderErrorStage
+	Err          error
+}
+
+func newProviderError(providerName ProviderName, stage ProviderErrorStage, err error) error {
+	return &ProviderError{
+		ProviderName: providerName,
+		Stage:        stage,
+		Err:          err,
+	}
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.ProviderName, e.Stage, e.Err)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// providerErrorStageOf falls back to the result stage for errors that
+// were not raised while talking to the provider.
+func providerErrorStageOf(err error) ProviderErrorStage {
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe.Stage
+	}
+	return ProviderErrorStageResult
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// exportRow is the shape of a subscriber in an email list export
+type exportRow struct {
+	ID                 string       `json:"id"`
+	Name               string       `json:"name"`
+	EmailAddr          string       `json:"emailAddr"`
+	SourceProviderName ProviderName `json:"sourceProviderName"`
+	CreatedAt          time.Time    `json:"createdAt"`
+	UpdatedAt          time.Time    `json:"updatedAt"`
+}
+
+var exportCSVHeader = []string{"id", "name", "emailAddr", "sourceProviderName", "createdAt", "updatedAt"}
+
+func newExportRow(subscriber *Subscriber) exportRow {
+	return exportRow{
+		ID:                 subscriber.ID,
+		Name:               subscriber.Name,
+		EmailAddr:          subscriber.EmailAddr,
+		SourceProviderName: subscriber.SourceProviderName,
+		CreatedAt:          subscriber.CreatedAt,
+		UpdatedAt:          subscriber.UpdatedAt,
+	}
+}
+
+func fileFormatContentType(format FileFormat) string {
+	if format == FileFormatJSONL {
+		return ContentTypeApplicationXNdjson
+	}
+	return ContentTypeTextCsv
+}
+
+// exportWriter writes subscribers to w one row at a time, so that an export
+// never has to hold more than the current chunk of subscribers in memory.
+type exportWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func newExportWriter(w io.Writer, format FileFormat) *exportWriter {
+	if format == FileFormatJSONL {
+		return &exportWriter{json: json.NewEncoder(w)}
+	}
+	return &exportWriter{csv: csv.NewWriter(w)}
+}
+
+// WriteHeader writes the CSV header row. JSONL exports have no header.
+func (ew *exportWriter) WriteHeader() error {
+	if ew.csv == nil {
+		return nil
+	}
+	return ew.csv.Write(exportCSVHeader)
+}
+
+func (ew *exportWriter) Write(subscriber *Subscriber) error {
+	row := newExportRow(subscriber)
+	if ew.json != nil {
+		return ew.json.Encode(row)
+	}
+
+	return ew.csv.Write([]string{
+		row.ID,
+		csvSafe(row.Name),
+		csvSafe(row.EmailAddr),
+		string(row.SourceProviderName),
+		row.CreatedAt.Format(time.RFC3339Nano),
+		row.UpdatedAt.Format(time.RFC3339Nano),
+	})
+}
+
+func (ew *exportWriter) Flush() error {
+	if ew.csv == nil {
+		return nil
+	}
+	ew.csv.Flush()
+	return ew.csv.Error()
+}
+
+// csvFormulaChars are the leading characters that make spreadsheets treat a cell as a formula
+const csvFormulaChars string = "=+-@\t\r"
+
+// csvSafe stops names and email addresses, which come from the visitor, from
+// being run as formulas when the export is opened in a spreadsheet
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaChars, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// csvUnsafe undoes csvSafe, so that exports can be imported again unchanged
+func csvUnsafe(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(csvFormulaChars, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
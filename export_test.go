@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportWriter(t *testing.T) {
+	createdAt := time.Date(2024, 8, 22, 20, 26, 6, 0, time.UTC)
+	subscriber := &Subscriber{
+		ID:                 "1",
+		Name:               "=HYPERLINK(\"https://example.com\")",
+		EmailAddr:          "tom@domain.com",
+		SourceProviderName: ProviderNameGoogle,
+		CreatedAt:          createdAt,
+		UpdatedAt:          createdAt,
+	}
+
+	var buf bytes.Buffer
+	ew := newExportWriter(&buf, FileFormatCSV)
+	assert.Nil(t, ew.WriteHeader())
+	assert.Nil(t, ew.Write(subscriber))
+	assert.Nil(t, ew.Flush())
+	assert.Equal(t, "id,name,emailAddr,sourceProviderName,createdAt,updatedAt\n"+
+		"1,\"'=HYPERLINK(\"\"https://example.com\"\")\",tom@domain.com,Google,2024-08-22T20:26:06Z,2024-08-22T20:26:06Z\n", buf.String())
+
+	// Importing the export gives back the original values
+	rows := []importRow{}
+	err := readImportRows(bytes.NewReader(buf.Bytes()), FileFormatCSV, func(line int, row importRow, err error) {
+		assert.Nil(t, err)
+		rows = append(rows, row)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []importRow{{Email: "tom@domain.com", Name: subscriber.Name, Source: "Google"}}, rows)
+	assert.Equal(t, "'quoted", csvUnsafe("'quoted"))
+
+	buf.Reset()
+	ew = newExportWriter(&buf, FileFormatJSONL)
+	assert.Nil(t, ew.WriteHeader())
+	assert.Nil(t, ew.Write(subscriber))
+	assert.Nil(t, ew.Write(subscriber))
+	assert.Nil(t, ew.Flush())
+	assert.Equal(t, 2, bytes.Count(buf.Bytes(), []byte("\n")))
+	assert.Contains(t, buf.String(), `"name":"=HYPERLINK(\"https://example.com\")"`)
+}
@@ -11,12 +11,9 @@ import (
 
 type FormDataMap map[string]io.Reader
 
-func (fdm FormDataMap) Upload(url string) error {
+func (fdm FormDataMap) Upload(url string) (int, error) {
 	// Prepare a form that will be submitted to the url
-	var (
-		b      = bytes.Buffer{}
-		client = http.Client{}
-	)
+	b := bytes.Buffer{}
 
 	mpw := multipart.NewWriter(&b)
 	for key, rdr := range fdm {
@@ -28,38 +25,43 @@ func (fdm FormDataMap) Upload(url string) error {
 		if file, ok := rdr.(*os.File); ok {
 			w, err := mpw.CreateFormFile(key, file.Name())
 			if err != nil {
-				return err
+				return 0, err
 			}
 			wrtr = w
 		} else {
 			// Add other fields
 			w, err := mpw.CreateFormField(key)
 			if err != nil {
-				return err
+				return 0, err
 			}
 			wrtr = w
 		}
 		_, err := io.Copy(wrtr, rdr)
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
 	mpw.Close()
 
 	req, err := http.NewRequest(http.MethodPost, url, &b)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	req.Header.Set(HTTPHeaderContentType, mpw.FormDataContentType())
 
-	resp, err := client.Do(req)
+	resp, err := outputHTTPClient.Do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("expected %d status code, but got %d", http.StatusOK, resp.StatusCode)
+		return resp.StatusCode, &StatusCodeError{
+			StatusCode: resp.StatusCode,
+			Err:        fmt.Errorf("expected %d status code, but got %d", http.StatusOK, resp.StatusCode),
+		}
 	}
 
-	return nil
+	return resp.StatusCode, nil
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 )
 
 const defaultCatchAllRedirectUrl = "https://bing.com"
@@ -35,6 +36,20 @@ func WriteUnauthorized(w http.ResponseWriter) error {
 	return WriteJSON(w, http.StatusUnauthorized, NewJsonResponse(false, nil, unauthorized()))
 }
 
+// QueryTime parses an RFC 3339 timestamp from the query param, returning nil if it is not set
+func QueryTime(r *http.Request, key string) (*time.Time, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return &t, nil
+}
+
 func TelegramAPIMessageUrl(botID string) string {
 	return fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", botID)
 }
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryTime(t *testing.T) {
+	r := httptest.NewRequest("GET", "/subscribers?createdAfter=2024-08-01T00:00:00Z&createdBefore=yesterday", nil)
+
+	createdAfter, err := QueryTime(r, QueryParamCreatedAfter)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC), *createdAfter)
+
+	_, err = QueryTime(r, QueryParamCreatedBefore)
+	assert.NotNil(t, err)
+
+	q, err := QueryTime(r, QueryParamQ)
+	assert.Nil(t, err)
+	assert.Nil(t, q)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+// importRow is a subscriber read from an import file. The emailAddr and
+// sourceProviderName fields of an export are accepted too, so that an
+// export can be imported into another list as is.
+type importRow struct {
+	Email              string `json:"email"`
+	EmailAddr          string `json:"emailAddr"`
+	Name               string `json:"name"`
+	Source             string `json:"source"`
+	SourceProviderName string `json:"sourceProviderName"`
+}
+
+type importColumn int
+
+const (
+	importColumnUnknown importColumn = iota
+	importColumnEmail
+	importColumnName
+	importColumnSource
+)
+
+// importColumnOf matches a CSV header to a column, ignoring case, spaces, dashes and underscores
+func importColumnOf(header string) importColumn {
+	header = strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(strings.TrimSpace(header)))
+	switch header {
+	case "email", "emailaddr", "emailaddress":
+		return importColumnEmail
+	case "name", "fullname":
+		return importColumnName
+	case "source", "sourceprovidername", "provider":
+		return importColumnSource
+	}
+	return importColumnUnknown
+}
+
+// readImportRows calls fn with each row of the file, along with its line number.
+// Rows that can't be read are passed to fn with an error, while an error
+// returned by readImportRows means the file as a whole could not be read.
+func readImportRows(r io.Reader, format FileFormat, fn func(line int, row importRow, err error)) error {
+	if format == FileFormatJSONL {
+		return readImportRowsJSONL(r, fn)
+	}
+	return readImportRowsCSV(r, fn)
+}
+
+func readImportRowsCSV(r io.Reader, fn func(line int, row importRow, err error)) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return missingImportEmailColumn()
+		}
+		return err
+	}
+
+	columns := make([]importColumn, len(header))
+	hasEmail := false
+	for i, h := range header {
+		// Spreadsheet apps often start CSV files with a byte order mark
+		if i == 0 {
+			h = strings.TrimPrefix(h, "\ufeff")
+		}
+		columns[i] = importColumnOf(h)
+		hasEmail = hasEmail || columns[i] == importColumnEmail
+	}
+	if !hasEmail {
+		return missingImportEmailColumn()
+	}
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		// A malformed row, such as one with a stray quote, doesn't stop the rest of the file from being read
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			fn(parseErr.StartLine, importRow{}, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		line, _ := cr.FieldPos(0)
+		row := importRow{}
+		for i, value := range record {
+			if i >= len(columns) {
+				break
+			}
+			value = csvUnsafe(value)
+			switch columns[i] {
+			case importColumnEmail:
+				row.Email = value
+			case importColumnName:
+				row.Name = value
+			case importColumnSource:
+				row.Source = value
+			}
+		}
+		fn(line, row, nil)
+	}
+}
+
+func readImportRowsJSONL(r io.Reader, fn func(line int, row importRow, err error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		b := scanner.Bytes()
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+
+		var row importRow
+		err := json.Unmarshal(b, &row)
+		fn(line, row, err)
+	}
+
+	return scanner.Err()
+}
+
+// newImportSubscriber validates the row, and makes it into a subscriber on the email list
+func newImportSubscriber(emailList *EmailList, row importRow) (*Subscriber, error) {
+	emailAddr, err := normalizeEmailAddr(fallbackIfEmpty(row.Email, row.EmailAddr))
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(row.Name)
+	if utf8.RuneCountInString(name) > maxSubscriberNameLength {
+		return nil, fieldTooLong("name", maxSubscriberNameLength)
+	}
+
+	source := strings.TrimSpace(fallbackIfEmpty(row.Source, row.SourceProviderName))
+	if utf8.RuneCountInString(source) > maxSourceProviderNameLength {
+		return nil, fieldTooLong("source", maxSourceProviderNameLength)
+	}
+
+	return NewSubscriber(
+		emailList.ID,
+		emailList.UserID,
+		ProviderName(fallbackIfEmpty(source, string(SubscriberSourceImport))),
+		name,
+		emailAddr,
+	), nil
+}
+
+// normalizeEmailAddr trims and lowercases the address, and checks that it is a bare
+// email address, rather than one with a display name such as "Tom <tom@domain.com>"
+func normalizeEmailAddr(emailAddr string) (string, error) {
+	emailAddr = strings.ToLower(strings.TrimSpace(emailAddr))
+	if emailAddr == "" {
+		return "", emailAddrNotProvided()
+	}
+	if utf8.RuneCountInString(emailAddr) > maxEmailAddrLength {
+		return "", fieldTooLong("email address", maxEmailAddrLength)
+	}
+
+	addr, err := mail.ParseAddress(emailAddr)
+	if err != nil || addr.Address != emailAddr {
+		return "", invalidEmailAddr(emailAddr)
+	}
+	return emailAddr, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeEmailAddr(t *testing.T) {
+	emailAddr, err := normalizeEmailAddr("  Tom.Jones@Domain.com ")
+	assert.Nil(t, err)
+	assert.Equal(t, "tom.jones@domain.com", emailAddr)
+
+	for _, invalid := range []string{"", "tom", "tom@", "Tom <tom@domain.com>", "tom@domain.com, jim@domain.com"} {
+		_, err := normalizeEmailAddr(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestReadImportRowsCSV(t *testing.T) {
+	file := "\ufeffName,E-mail Address,Source,Notes\n" +
+		"Tom Jones,tom@domain.com,Mailchimp,vip\n" +
+		"Jim Bob,jim@domain.com\n"
+
+	lines := []int{}
+	rows := []importRow{}
+	err := readImportRows(strings.NewReader(file), FileFormatCSV, func(line int, row importRow, err error) {
+		assert.Nil(t, err)
+		lines = append(lines, line)
+		rows = append(rows, row)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2, 3}, lines)
+	assert.Equal(t, importRow{Email: "tom@domain.com", Name: "Tom Jones", Source: "Mailchimp"}, rows[0])
+	assert.Equal(t, importRow{Email: "jim@domain.com", Name: "Jim Bob"}, rows[1])
+
+	err = readImportRows(strings.NewReader("name\nTom Jones\n"), FileFormatCSV, func(int, importRow, error) {})
+	assert.NotNil(t, err)
+
+	lines = []int{}
+	errs := []error{}
+	err = readImportRows(strings.NewReader("email\nto\"m@domain.com\njim@domain.com\n"), FileFormatCSV, func(line int, row importRow, err error) {
+		lines = append(lines, line)
+		errs = append(errs, err)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2, 3}, lines)
+	assert.NotNil(t, errs[0])
+	assert.Nil(t, errs[1])
+}
+
+func TestReadImportRowsJSONL(t *testing.T) {
+	file := `{"emailAddr":"tom@domain.com","name":"Tom Jones","sourceProviderName":"Google"}` + "\n" +
+		"\n" +
+		`{"email":` + "\n"
+
+	lines := []int{}
+	errs := []error{}
+	err := readImportRows(strings.NewReader(file), FileFormatJSONL, func(line int, row importRow, err error) {
+		lines = append(lines, line)
+		errs = append(errs, err)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 3}, lines)
+	assert.Nil(t, errs[0])
+	assert.NotNil(t, errs[1])
+
+	subscriber, err := newImportSubscriber(&EmailList{ID: "1", UserID: "2"}, importRow{EmailAddr: "Tom@Domain.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, "tom@domain.com", subscriber.EmailAddr)
+	assert.Equal(t, SubscriberSourceImport, subscriber.SourceProviderName)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
@@ -8,9 +9,12 @@ import (
 )
 
 var (
-	decenc  *OAuthDecEncoder
-	server  *Server
-	storage *Storage
+	credentialCipher       *CredentialCipher
+	decenc                 *OAuthDecEncoder
+	dispatcher             *Dispatcher
+	genericProviderConfigs map[ProviderName]GenericProviderConfig
+	server                 *Server
+	storage                *Storage
 )
 
 func init() {
@@ -29,6 +33,18 @@ func init() {
 
 	decenc = NewOAuthDecEncoder(secret, oauthDecEncDelim)
 
+	cc, err := NewCredentialCipher(secret)
+	if err != nil {
+		log.Fatal(err)
+	}
+	credentialCipher = cc
+
+	providerConfigs, err := LoadGenericProviderConfigs()
+	if err != nil {
+		log.Fatal(err)
+	}
+	genericProviderConfigs = providerConfigs
+
 	postgresConnStr := os.Getenv(EnvPostgresConnStr)
 	if postgresConnStr == "" {
 		log.Fatal(missingEnv(EnvPostgresConnStr))
@@ -39,11 +55,19 @@ func init() {
 		log.Fatal(err)
 	}
 
+	dispatcher = NewDispatcher(outboxBatchSize, outboxPollInterval)
+
 	listenAddr := fmtPort(fallbackIfEmpty(os.Getenv(EnvPort), defaultListenAddr))
 	server = NewServer(listenAddr)
 }
 
 func main() {
+	// Lambda invocations are frozen between requests, so retries are
+	// driven by POST /outbox/dispatch there instead of a background loop
+	if !runningFromServerless() {
+		go dispatcher.Run(context.Background())
+	}
+
 	err := server.Run()
 	if err != nil {
 		log.Fatal(err)
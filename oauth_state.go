@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// OAuthState is the campaign context for a single visit to an OAuth provider.
+// It is stored server-side, keyed by a random state parameter that is sent to
+// the provider and handed back on the callback, along with the PKCE code verifier
+// for the visit.
+type OAuthState struct {
+	State        string
+	CodeVerifier string
+	EmailListID  string
+	ProviderName ProviderName
+	OutputIDs    []string
+	RedirectUrl  string
+	CreatedAt    time.Time
+}
+
+func NewOAuthState(emailListID string, providerName ProviderName, outputIDs []string, redirectUrl string) (*OAuthState, error) {
+	state, err := newOAuthStateStr()
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthState{
+		State:        state,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		EmailListID:  emailListID,
+		ProviderName: providerName,
+		OutputIDs:    outputIDs,
+		RedirectUrl:  redirectUrl,
+		CreatedAt:    time.Now(),
+	}, nil
+}
+
+// ConsumeOAuthState looks up the campaign context for the state parameter on a
+// provider callback. Each state can only be consumed once, so replayed callbacks
+// are rejected, as are states that were issued for a different provider.
+func ConsumeOAuthState(r *http.Request, providerName ProviderName) (*OAuthState, error) {
+	state := r.URL.Query().Get(QueryParamState)
+	if state == "" {
+		return nil, invalidOAuthState()
+	}
+
+	st, err := storage.ConsumeOAuthState(state, time.Now().Add(-oauthStateMaxAge))
+	if err != nil {
+		return nil, err
+	}
+	if st.ProviderName != providerName {
+		return nil, fmt.Errorf("oauth state was issued for %s, not %s", st.ProviderName, providerName)
+	}
+
+	return st, nil
+}
+
+// AuthCodeOptions returns the PKCE challenge to send with the authorization request
+func (st OAuthState) AuthCodeOptions() []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(st.CodeVerifier)}
+}
+
+// ExchangeOptions returns the PKCE verifier to send with the token exchange
+func (st OAuthState) ExchangeOptions() []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{oauth2.VerifierOption(st.CodeVerifier)}
+}
+
+func (st OAuthState) Handle(pr ProviderResult) error {
+	if pr.EmailAddr == "" {
+		return missingEmailAddr(st.ProviderName)
+	}
+	pr = pr.Truncated()
+
+	// Addresses are compared ignoring case, so the same person signing in
+	// with a differently cased address is recognized as a rejoin
+	emailAddr, err := normalizeEmailAddr(pr.EmailAddr)
+	if err != nil {
+		return err
+	}
+
+	emailList, err := storage.GetEmailListByID(st.EmailListID)
+	if err != nil {
+		return err
+	}
+	userID := emailList.UserID
+
+	subscriber := NewSubscriber(st.EmailListID, userID, st.ProviderName, pr.Name, emailAddr)
+	subscriber.EmailVerified = pr.EmailVerified
+	subscriber.ProviderSubjectID = pr.ProviderSubjectID
+	subscriber.GivenName = pr.GivenName
+	subscriber.FamilyName = pr.FamilyName
+	subscriber.AvatarURL = pr.AvatarURL
+	subscriber.Locale = pr.Locale
+	subscriber.RawProfile = pr.RawProfile
+
+	// The policy is applied before anything is written to the outbox,
+	// so rejected addresses never reach an output
+	if !pr.EmailVerified {
+		switch emailList.UnverifiedEmailPolicy {
+		case UnverifiedEmailPolicyReject:
+			return unverifiedEmailAddr(st.ProviderName)
+		case UnverifiedEmailPolicyTag:
+			subscriber.Tags = append(subscriber.Tags, SubscriberTagUnverified)
+		}
+	}
+
+	outputIDs, err := st.outputIDsOrDefaults(emailList.ID)
+	if err != nil {
+		return err
+	}
+
+	// Deliveries are written to the outbox before they are attempted,
+	// so that a failing output can be retried later instead of losing the lead.
+	// The outbox jobs carry the ID of the stored subscriber, which is
+	// the existing one when the visitor has joined this list before.
+	_, jobs, err := storage.UpsertSubscriber(subscriber, st.ProviderName, outputIDs)
+	if err != nil {
+		return err
+	}
+
+	jobIDs := []string{}
+	for _, job := range jobs {
+		jobIDs = append(jobIDs, job.ID)
+	}
+	if err := dispatcher.DispatchByIDs(jobIDs); err != nil {
+		log.Print(err)
+	}
+
+	return nil
+}
+
+// outputIDsOrDefaults returns the campaign's output IDs, falling back to
+// the email list's default outputs for campaigns without any o= params
+func (st OAuthState) outputIDsOrDefaults(emailListID string) ([]string, error) {
+	outputIDs := []string{}
+	for _, outputID := range st.OutputIDs {
+		if outputID != "" {
+			outputIDs = append(outputIDs, outputID)
+		}
+	}
+	if len(outputIDs) > 0 {
+		return outputIDs, nil
+	}
+
+	outputs, err := storage.GetAllOutputsByEmailListID(emailListID)
+	if err != nil {
+		return nil, err
+	}
+	for _, output := range outputs {
+		outputIDs = append(outputIDs, output.GetID())
+	}
+	return outputIDs, nil
+}
+
+// RecordFailure stores a failed sign-in against the campaign it came from,
+// so list owners can see why visitors are not turning into subscribers.
+func (st OAuthState) RecordFailure(err error) {
+	userID := ""
+	if emailList, err := storage.GetEmailListByID(st.EmailListID); err == nil {
+		userID = emailList.UserID
+	}
+
+	failure := NewProviderFailure(st.EmailListID, userID, st.ProviderName, err)
+	if err := storage.InsertNewProviderFailure(failure); err != nil {
+		log.Print(err)
+	}
+}
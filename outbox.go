@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Dispatcher works the outbox_jobs table, handing each job's subscriber to its
+// Output and rescheduling failed deliveries with exponential backoff until they
+// succeed or run out of attempts.
+type Dispatcher struct {
+	batchSize    int
+	pollInterval time.Duration
+}
+
+func NewDispatcher(batchSize int, pollInterval time.Duration) *Dispatcher {
+	return &Dispatcher{
+		batchSize:    batchSize,
+		pollInterval: pollInterval,
+	}
+}
+
+// Run polls for due jobs until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.DispatchDue(); err != nil {
+			log.Print(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchDue claims and delivers every job whose next attempt is due.
+func (d *Dispatcher) DispatchDue() error {
+	return d.dispatchDueUntil(time.Time{})
+}
+
+// DispatchDueWithin stops claiming jobs once the budget has passed, so that it can
+// be called from a request with a timeout. Jobs that are still due are left for the next call.
+func (d *Dispatcher) DispatchDueWithin(budget time.Duration) error {
+	return d.dispatchDueUntil(time.Now().Add(budget))
+}
+
+func (d *Dispatcher) dispatchDueUntil(deadline time.Time) error {
+	for {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil
+		}
+
+		jobs, err := storage.ClaimDueOutboxJobs(d.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+
+		d.dispatchAll(jobs)
+
+		if len(jobs) < d.batchSize {
+			return nil
+		}
+	}
+}
+
+// DispatchByIDs delivers the given jobs right away, without waiting for the next poll.
+func (d *Dispatcher) DispatchByIDs(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	jobs, err := storage.ClaimOutboxJobsByIDs(ids)
+	if err != nil {
+		return err
+	}
+
+	d.dispatchAll(jobs)
+	return nil
+}
+
+// dispatchAll delivers to different outputs concurrently, but to each output one job
+// at a time, waiting outboxOutputInterval between them to stay within rate limits
+func (d *Dispatcher) dispatchAll(jobs []*OutboxJob) {
+	groups := groupOutboxJobsByOutputID(jobs)
+
+	var wg sync.WaitGroup
+	wg.Add(len(groups))
+
+	for _, group := range groups {
+		go func() {
+			defer wg.Done()
+			for i, job := range group {
+				if i > 0 {
+					time.Sleep(outboxOutputInterval)
+				}
+				d.dispatch(job)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// groupOutboxJobsByOutputID keeps the jobs of each output in the order they were given
+func groupOutboxJobsByOutputID(jobs []*OutboxJob) [][]*OutboxJob {
+	groups := [][]*OutboxJob{}
+	indexes := map[string]int{}
+	for _, job := range jobs {
+		i, ok := indexes[job.OutputID]
+		if !ok {
+			i = len(groups)
+			indexes[job.OutputID] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], job)
+	}
+	return groups
+}
+
+func (d *Dispatcher) dispatch(job *OutboxJob) {
+	job.Attempts++
+
+	err := d.deliver(job)
+	if err == nil {
+		job.Status = OutboxJobStatusSucceeded
+		job.LastError = ""
+	} else if job.Attempts >= job.MaxAttempts {
+		log.Printf("outbox job %s moved to dead letter after %d attempts: %s", job.ID, job.Attempts, err)
+		job.Status = OutboxJobStatusDead
+		job.LastError = err.Error()
+	} else {
+		job.Status = OutboxJobStatusPending
+		job.LastError = err.Error()
+		job.NextAttemptAt = time.Now().Add(outboxBackoff(job.Attempts))
+	}
+
+	if err := storage.UpdateOutboxJobResult(job); err != nil {
+		log.Print(err)
+	}
+}
+
+func (d *Dispatcher) deliver(job *OutboxJob) error {
+	output, err := storage.GetOutputByIDAndUserID(job.OutputID, job.UserID)
+	if err != nil {
+		// The failed attempt is still recorded, so that a job whose output
+		// was deleted doesn't dead-letter without a trace in its deliveries
+		recordDelivery(NewDelivery(job.ID, job.OutputID, job.UserID, job.Subscriber.ID, 0, 0, err))
+		return err
+	}
+	return Deliver(output, job.Subscriber, job.ID)
+}
+
+// outboxBackoff returns how long to wait before retrying a job that has failed
+// the given number of attempts.
+func outboxBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return outboxBaseBackoff
+	}
+
+	backoff := outboxBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= outboxMaxBackoff {
+			return outboxMaxBackoff
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	assert.Equal(t, outboxBaseBackoff, outboxBackoff(0))
+	assert.Equal(t, outboxBaseBackoff, outboxBackoff(1))
+	assert.Equal(t, outboxBaseBackoff*2, outboxBackoff(2))
+	assert.Equal(t, outboxBaseBackoff*4, outboxBackoff(3))
+
+	for attempts := 1; attempts < 100; attempts++ {
+		assert.LessOrEqual(t, outboxBackoff(attempts), outboxMaxBackoff)
+		assert.LessOrEqual(t, outboxBackoff(attempts), outboxBackoff(attempts+1))
+	}
+	assert.Equal(t, outboxMaxBackoff, outboxBackoff(outboxMaxAttempts*10))
+}
+
+func TestGroupOutboxJobsByOutputID(t *testing.T) {
+	jobs := []*OutboxJob{
+		{ID: "1", OutputID: "a"},
+		{ID: "2", OutputID: "b"},
+		{ID: "3", OutputID: "a"},
+		{ID: "4", OutputID: "a"},
+	}
+
+	groups := groupOutboxJobsByOutputID(jobs)
+	assert.Equal(t, 2, len(groups))
+	assert.Equal(t, []*OutboxJob{jobs[0], jobs[2], jobs[3]}, groups[0])
+	assert.Equal(t, []*OutboxJob{jobs[1]}, groups[1])
+
+	assert.Empty(t, groupOutboxJobsByOutputID(nil))
+}
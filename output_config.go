@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// outputConfigSchemas describes the config of each output, and is what
+// configs are validated against when an output is created or updated
+var outputConfigSchemas = map[OutputName]*JSONSchema{
+	OutputNameAWeber: objectSchema(
+		"Adds the subscriber to an AWeber list",
+		map[string]*JSONSchema{
+			"listId":     requiredStringSchema("The name of the AWeber list"),
+			"adTracking": stringSchema("The ad tracking value to record against the subscriber"),
+		},
+		"listId",
+	),
+	OutputNameBrevo: objectSchema(
+		"Adds the subscriber to a Brevo list",
+		map[string]*JSONSchema{
+			"listId": numericIDSchema("The numeric ID of the Brevo list"),
+			"apiKey": credentialSchema("The API key of the Brevo account, which defaults to the BREVO_API_KEY env var"),
+		},
+		"listId",
+	),
+	OutputNameConvertKit: {
+		Type:        "object",
+		Description: "Subscribes the subscriber to a ConvertKit (Kit) form, tag, or both",
+		Properties: map[string]*JSONSchema{
+			"apiKey": credentialSchema("The API key of the ConvertKit account"),
+			"formId": numericIDSchema("The numeric ID of the ConvertKit form"),
+			"tagId":  numericIDSchema("The numeric ID of the ConvertKit tag"),
+		},
+		Required:             []string{"apiKey"},
+		AdditionalProperties: false,
+		AnyOf: []*JSONSchema{
+			{Required: []string{"formId"}},
+			{Required: []string{"tagId"}},
+		},
+	},
+	OutputNameDiscord: {
+		Type:        "object",
+		Description: "Posts a message to a Discord channel through one of its webhooks",
+		Properties: map[string]*JSONSchema{
+			"webhookUrl": {
+				Type:        "string",
+				Description: "The URL of the Discord channel webhook",
+				Pattern:     `^https://(discord|discordapp)\.com/api/webhooks/`,
+				WriteOnly:   true,
+			},
+			"msgFmt": {
+				Type:        "string",
+				Description: "The message to send, which can use template variables such as {{emailAddr}}",
+				MinLength:   1,
+				MaxLength:   discordMaxContentLength,
+			},
+			"embeds": {
+				Type:        "array",
+				Description: "Discord embed objects, whose strings can use the same template variables as msgFmt",
+				Items:       anyObjectSchema(),
+				MaxItems:    discordMaxEmbeds,
+			},
+		},
+		Required:             []string{"webhookUrl"},
+		AdditionalProperties: false,
+		AnyOf: []*JSONSchema{
+			{Required: []string{"msgFmt"}},
+			{Required: []string{"embeds"}},
+		},
+	},
+	OutputNameMailchimp: objectSchema(
+		"Adds or updates the subscriber as a member of a Mailchimp audience",
+		map[string]*JSONSchema{
+			"audienceId": requiredStringSchema("The ID of the Mailchimp audience"),
+			"status": {
+				Type:        "string",
+				Description: "The status of new members, which defaults to subscribed. Pending members are sent a confirmation email first",
+				Enum: []string{
+					string(MailchimpMemberStatusSubscribed),
+					string(MailchimpMemberStatusPending),
+				},
+			},
+			"tags": {
+				Type:        "array",
+				Description: "Tags to add to the member",
+				Items:       requiredStringSchema(""),
+			},
+			"apiKey": credentialSchema("The API key of the Mailchimp account, which defaults to the MAILCHIMP_API_KEY env var"),
+		},
+		"audienceId",
+	),
+	OutputNameMailerLite: objectSchema(
+		"Adds the subscriber to a MailerLite group",
+		map[string]*JSONSchema{
+			"apiKey":  credentialSchema("The API token of the MailerLite account"),
+			"groupId": numericIDSchema("The numeric ID of the MailerLite group"),
+		},
+		"apiKey",
+		"groupId",
+	),
+	OutputNameResend: objectSchema(
+		"Adds the subscriber to a Resend audience",
+		map[string]*JSONSchema{
+			"audienceId": requiredStringSchema("The ID of the Resend audience"),
+			"apiKey":     credentialSchema("The API key of the Resend account, which defaults to the RESEND_API_KEY env var"),
+		},
+		"audienceId",
+	),
+	OutputNameSlack: {
+		Type:        "object",
+		Description: "Posts a message to a Slack channel through an incoming webhook",
+		Properties: map[string]*JSONSchema{
+			"webhookUrl": {
+				Type:        "string",
+				Description: "The URL of the Slack incoming webhook",
+				Pattern:     `^https://hooks\.slack\.com/`,
+				WriteOnly:   true,
+			},
+			"msgFmt": requiredStringSchema("The message to send, which can use template variables such as {{emailAddr}}. When there are blocks, it is shown in notifications"),
+			"blocks": {
+				Type:        "array",
+				Description: "Slack Block Kit blocks, whose strings can use the same template variables as msgFmt",
+				Items:       anyObjectSchema(),
+				MaxItems:    slackMaxBlocks,
+			},
+		},
+		Required:             []string{"webhookUrl"},
+		AdditionalProperties: false,
+		AnyOf: []*JSONSchema{
+			{Required: []string{"msgFmt"}},
+			{Required: []string{"blocks"}},
+		},
+	},
+	OutputNameTelegram: objectSchema(
+		"Sends a message to a Telegram chat",
+		map[string]*JSONSchema{
+			"chatId": requiredStringSchema("The ID of the Telegram chat"),
+			"msgFmt": requiredStringSchema("The message to send, which can use template variables such as {{emailAddr}}"),
+			"botId":  credentialSchema("The ID of the Telegram bot, which defaults to the TELEGRAM_BOT_ID env var"),
+		},
+		"chatId",
+		"msgFmt",
+	),
+	OutputNameWebhook: objectSchema(
+		"Makes a request to a URL, sending the subscriber as a JSON event unless the method is GET",
+		map[string]*JSONSchema{
+			"urlFmt": requiredStringSchema("The URL to request, which can use template variables such as {{emailAddr}}"),
+			"method": {
+				Type:        "string",
+				Description: "The HTTP method to use, which defaults to GET",
+				Enum:        webhookMethods,
+			},
+			// Headers often carry API keys, so they are kept with the credentials
+			"headers": {
+				Type:                 "object",
+				Description:          "Extra headers to send with each request, which are replaced as a whole when updated",
+				AdditionalProperties: stringSchema(""),
+				WriteOnly:            true,
+			},
+			"secret": {
+				Type:        "string",
+				Description: "When set, each request is signed with HMAC-SHA256 using this secret",
+				MinLength:   16,
+				WriteOnly:   true,
+			},
+		},
+		"urlFmt",
+	),
+}
+
+// objectSchema makes the schema of an object that does not allow any properties besides the given ones
+func objectSchema(description string, properties map[string]*JSONSchema, required ...string) *JSONSchema {
+	return &JSONSchema{
+		Type:                 "object",
+		Description:          description,
+		Properties:           properties,
+		Required:             required,
+		AdditionalProperties: false,
+	}
+}
+
+// anyObjectSchema is an object with any properties, for formats that are
+// defined by a third-party, such as Slack blocks and Discord embeds
+func anyObjectSchema() *JSONSchema {
+	return &JSONSchema{Type: "object", AdditionalProperties: &JSONSchema{}}
+}
+
+func stringSchema(description string) *JSONSchema {
+	return &JSONSchema{Type: "string", Description: description}
+}
+
+// numericIDSchema is a string of digits, for APIs that identify resources by number
+func numericIDSchema(description string) *JSONSchema {
+	return &JSONSchema{Type: "string", Description: description, MinLength: 1, Pattern: "^[0-9]+$"}
+}
+
+// credentialSchema is a string that is stored encrypted, and never returned by the API
+func credentialSchema(description string) *JSONSchema {
+	return &JSONSchema{Type: "string", Description: description, MinLength: 1, WriteOnly: true}
+}
+
+// requiredStringSchema is a string that can't be empty
+func requiredStringSchema(description string) *JSONSchema {
+	return &JSONSchema{Type: "string", Description: description, MinLength: 1}
+}
+
+// ValidateOutputConfig checks the config against the schema for the output name
+func ValidateOutputConfig(outputName OutputName, config json.RawMessage) error {
+	schema, ok := outputConfigSchemas[outputName]
+	if !ok {
+		return &OutputConfigError{OutputName: outputName, Err: unknownOutputName(outputName)}
+	}
+
+	if len(bytes.TrimSpace(config)) == 0 {
+		config = json.RawMessage("{}")
+	}
+
+	var v any
+	d := json.NewDecoder(bytes.NewReader(config))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return &OutputConfigError{OutputName: outputName, Err: err}
+	}
+
+	if err := schema.validate("config", v); err != nil {
+		return &OutputConfigError{OutputName: outputName, Err: err}
+	}
+	return nil
+}
+
+func (s *JSONSchema) validate(path string, v any) error {
+	if obj, ok := v.(map[string]any); ok {
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s.%s is missing", path, name)
+			}
+		}
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s must be an object", path)
+		}
+
+		// Sorted so that the same config always fails on the same field
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			if !ok {
+				additional, ok := s.AdditionalProperties.(*JSONSchema)
+				if !ok {
+					return fmt.Errorf("%s.%s is not a known field", path, name)
+				}
+				property = additional
+			}
+			if err := property.validate(path+"."+name, obj[name]); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s must be an array", path)
+		}
+		if s.MaxItems > 0 && len(arr) > s.MaxItems {
+			return fmt.Errorf("%s must have at most %d items", path, s.MaxItems)
+		}
+		for i, item := range arr {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", path)
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+		if _, err := n.Int64(); err != nil {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", path)
+		}
+		length := utf8.RuneCountInString(str)
+		if length < s.MinLength {
+			if s.MinLength == 1 {
+				return fmt.Errorf("%s cannot be empty", path)
+			}
+			return fmt.Errorf("%s must be at least %d characters", path, s.MinLength)
+		}
+		if s.MaxLength > 0 && length > s.MaxLength {
+			return fmt.Errorf("%s must be at most %d characters", path, s.MaxLength)
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, str) {
+			return fmt.Errorf("%s must be one of %v", path, s.Enum)
+		}
+		if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(str) {
+			return fmt.Errorf("%s must match %s", path, s.Pattern)
+		}
+	}
+
+	if len(s.AnyOf) > 0 {
+		errs := make([]string, 0, len(s.AnyOf))
+		for _, schema := range s.AnyOf {
+			err := schema.validate(path, v)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return errors.New(strings.Join(errs, ", or "))
+	}
+	return nil
+}
+
+// mergeOutputConfig applies the top level fields of patch to config,
+// removing any that are set to null
+func mergeOutputConfig(config json.RawMessage, patch json.RawMessage) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(patch)) == 0 {
+		return config, nil
+	}
+
+	merged := map[string]json.RawMessage{}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &merged); err != nil {
+			return nil, err
+		}
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(patch, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range fields {
+		if string(value) == "null" {
+			delete(merged, name)
+			continue
+		}
+		merged[name] = value
+	}
+
+	return json.Marshal(merged)
+}
+
+func decodeOutputConfig[T any](config json.RawMessage) (T, error) {
+	var c T
+	if len(config) == 0 {
+		return c, nil
+	}
+	err := json.Unmarshal(config, &c)
+	return c, err
+}
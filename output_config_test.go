@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOutputConfig(t *testing.T) {
+	type test struct {
+		outputName OutputName
+		config     string
+		valid      bool
+	}
+
+	tests := []test{
+		{OutputNameAWeber, `{"listId": "my-list"}`, true},
+		{OutputNameAWeber, `{"listId": "my-list", "adTracking": "fb"}`, true},
+		{OutputNameAWeber, `{"adTracking": "fb"}`, false},
+		{OutputNameBrevo, `{"listId": "12"}`, true},
+		{OutputNameBrevo, `{"listId": "twelve"}`, false},
+		{OutputNameBrevo, `{"listId": 12}`, false},
+		{OutputNameConvertKit, `{"apiKey": "ck_key", "formId": "123"}`, true},
+		{OutputNameConvertKit, `{"apiKey": "ck_key", "formId": "123", "tagId": "456"}`, true},
+		{OutputNameConvertKit, `{"apiKey": "ck_key"}`, false},
+		{OutputNameConvertKit, `{"formId": "123"}`, false},
+		{OutputNameMailerLite, `{"apiKey": "ml_key", "groupId": "98765"}`, true},
+		{OutputNameMailerLite, `{"apiKey": "ml_key"}`, false},
+		{OutputNameDiscord, `{"webhookUrl": "https://discord.com/api/webhooks/123/abc", "msgFmt": "New subscriber: {{name}}"}`, true},
+		{OutputNameDiscord, `{"webhookUrl": "https://discord.com/api/webhooks/123/abc", "embeds": [{"title": "{{name}}"}]}`, true},
+		{OutputNameDiscord, `{"webhookUrl": "https://discord.com/api/webhooks/123/abc"}`, false},
+		{OutputNameDiscord, `{"webhookUrl": "https://example.com/api/webhooks/123/abc", "msgFmt": "hi"}`, false},
+		{OutputNameDiscord, `{"webhookUrl": "https://discord.com/api/webhooks/123/abc", "embeds": ["{{name}}"]}`, false},
+		{OutputNameResend, `{"audienceId": ""}`, false},
+		{OutputNameSlack, `{"webhookUrl": "https://hooks.slack.com/services/T0/B0/x", "msgFmt": "hi", "blocks": [{"type": "divider"}]}`, true},
+		{OutputNameSlack, `{"webhookUrl": "https://hooks.slack.com/services/T0/B0/x", "blocks": {"type": "divider"}}`, false},
+		{OutputNameTelegram, `{"chatId": "-100123", "msgFmt": "New subscriber: {{emailAddr}}"}`, true},
+		{OutputNameTelegram, `{"chatId": "-100123"}`, false},
+		{OutputNameWebhook, `{"urlFmt": "https://example.com?email={{emailAddr}}", "param1": "x"}`, false},
+		{OutputNameWebhook, ``, false},
+		{OutputNameWebhook, `["https://example.com"]`, false},
+		{"carrier-pigeon", `{}`, false},
+	}
+
+	for _, test := range tests {
+		err := ValidateOutputConfig(test.outputName, json.RawMessage(test.config))
+		if test.valid {
+			assert.Nil(t, err, test.config)
+			continue
+		}
+
+		var ce *OutputConfigError
+		assert.True(t, errors.As(err, &ce), test.config)
+	}
+}
+
+func TestMakeOutput(t *testing.T) {
+	now := time.Now()
+	output, err := makeOutput("1", "2", OutputNameTelegram, json.RawMessage(`{"chatId": "-100123", "msgFmt": "hi"}`), now, now)
+	assert.Nil(t, err)
+
+	to, ok := output.(TelegramOutput)
+	assert.True(t, ok)
+	assert.Equal(t, "-100123", to.ChatID)
+	assert.Equal(t, "hi", to.MsgFmt)
+
+	// The config is flattened into the output when it is returned
+	b, err := json.Marshal(output)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"chatId":"-100123"`)
+
+	_, err = makeOutput("1", "2", "carrier-pigeon", nil, now, now)
+	assert.NotNil(t, err)
+}
+
+func TestMergeOutputConfig(t *testing.T) {
+	merged, err := mergeOutputConfig(
+		json.RawMessage(`{"listId": "my-list", "adTracking": "fb"}`),
+		json.RawMessage(`{"listId": "other-list", "adTracking": null}`),
+	)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"listId": "other-list"}`, string(merged))
+}
@@ -3,7 +3,13 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -16,62 +22,138 @@ import (
 	sendinblue "github.com/sendinblue/APIv3-go-library/v2/lib"
 )
 
+// makeOutput decodes the config into the concrete output for the output name
 func makeOutput(
 	id string,
 	userID string,
 	outputName OutputName,
-	listID string,
-	param1 string,
-	param2 string,
-	param3 string,
+	config json.RawMessage,
 	createdAt time.Time,
 	updatedAt time.Time,
-) Output {
+) (Output, error) {
 	switch outputName {
 	case OutputNameAWeber:
-		return AWeberOutput{
-			ID:         id,
-			UserID:     userID,
-			ListID:     listID,
-			AdTracking: param1,
-			CreatedAt:  createdAt,
-			UpdatedAt:  updatedAt,
+		c, err := decodeOutputConfig[AWeberOutputConfig](config)
+		if err != nil {
+			return nil, err
 		}
+		return AWeberOutput{
+			ID:                 id,
+			UserID:             userID,
+			AWeberOutputConfig: c,
+			CreatedAt:          createdAt,
+			UpdatedAt:          updatedAt,
+		}, nil
 	case OutputNameBrevo:
+		c, err := decodeOutputConfig[BrevoOutputConfig](config)
+		if err != nil {
+			return nil, err
+		}
 		return BrevoOutput{
-			ID:        id,
-			UserID:    userID,
-			ListID:    listID,
-			CreatedAt: createdAt,
-			UpdatedAt: updatedAt,
+			ID:                id,
+			UserID:            userID,
+			BrevoOutputConfig: c,
+			CreatedAt:         createdAt,
+			UpdatedAt:         updatedAt,
+		}, nil
+	case OutputNameConvertKit:
+		c, err := decodeOutputConfig[ConvertKitOutputConfig](config)
+		if err != nil {
+			return nil, err
+		}
+		return ConvertKitOutput{
+			ID:                     id,
+			UserID:                 userID,
+			ConvertKitOutputConfig: c,
+			CreatedAt:              createdAt,
+			UpdatedAt:              updatedAt,
+		}, nil
+	case OutputNameDiscord:
+		c, err := decodeOutputConfig[DiscordOutputConfig](config)
+		if err != nil {
+			return nil, err
+		}
+		return DiscordOutput{
+			ID:                  id,
+			UserID:              userID,
+			DiscordOutputConfig: c,
+			CreatedAt:           createdAt,
+			UpdatedAt:           updatedAt,
+		}, nil
+	case OutputNameMailchimp:
+		c, err := decodeOutputConfig[MailchimpOutputConfig](config)
+		if err != nil {
+			return nil, err
 		}
+		return MailchimpOutput{
+			ID:                    id,
+			UserID:                userID,
+			MailchimpOutputConfig: c,
+			CreatedAt:             createdAt,
+			UpdatedAt:             updatedAt,
+		}, nil
+	case OutputNameMailerLite:
+		c, err := decodeOutputConfig[MailerLiteOutputConfig](config)
+		if err != nil {
+			return nil, err
+		}
+		return MailerLiteOutput{
+			ID:                     id,
+			UserID:                 userID,
+			MailerLiteOutputConfig: c,
+			CreatedAt:              createdAt,
+			UpdatedAt:              updatedAt,
+		}, nil
 	case OutputNameResend:
+		c, err := decodeOutputConfig[ResendOutputConfig](config)
+		if err != nil {
+			return nil, err
+		}
 		return ResendOutput{
-			ID:         id,
-			UserID:     userID,
-			AudienceID: listID,
-			CreatedAt:  createdAt,
-			UpdatedAt:  updatedAt,
+			ID:                 id,
+			UserID:             userID,
+			ResendOutputConfig: c,
+			CreatedAt:          createdAt,
+			UpdatedAt:          updatedAt,
+		}, nil
+	case OutputNameSlack:
+		c, err := decodeOutputConfig[SlackOutputConfig](config)
+		if err != nil {
+			return nil, err
 		}
+		return SlackOutput{
+			ID:                id,
+			UserID:            userID,
+			SlackOutputConfig: c,
+			CreatedAt:         createdAt,
+			UpdatedAt:         updatedAt,
+		}, nil
 	case OutputNameTelegram:
-		return TelegramOutput{
-			ID:        id,
-			UserID:    userID,
-			ChatID:    listID,
-			MsgFmt:    param1,
-			CreatedAt: createdAt,
-			UpdatedAt: updatedAt,
+		c, err := decodeOutputConfig[TelegramOutputConfig](config)
+		if err != nil {
+			return nil, err
 		}
+		return TelegramOutput{
+			ID:                   id,
+			UserID:               userID,
+			TelegramOutputConfig: c,
+			CreatedAt:            createdAt,
+			UpdatedAt:            updatedAt,
+		}, nil
 	case OutputNameWebhook:
-		return WebhookOutput{
-			ID:        id,
-			UserID:    userID,
-			UrlFmt:    param1,
-			CreatedAt: createdAt,
-			UpdatedAt: updatedAt,
+		c, err := decodeOutputConfig[WebhookOutputConfig](config)
+		if err != nil {
+			return nil, err
 		}
+		return WebhookOutput{
+			ID:                  id,
+			UserID:              userID,
+			WebhookOutputConfig: c,
+			CreatedAt:           createdAt,
+			UpdatedAt:           updatedAt,
+		}, nil
 	}
-	return nil
+	return nil, unknownOutputName(outputName)
 }
 
 func makeOutputsData(outputs []Output) OutputsData {
@@ -98,16 +180,33 @@ func (ao AWeberOutput) OutputName() OutputName {
 	return OutputNameAWeber
 }
 
+func (ao AWeberOutput) GetID() string {
+	return ao.ID
+}
+
 func (ao AWeberOutput) GetUserID() string {
 	return ao.UserID
 }
 
-func (ao AWeberOutput) Handle(emailAddr string, name string) error {
+func (ao AWeberOutput) GetCreatedAt() time.Time {
+	return ao.CreatedAt
+}
+
+func (ao AWeberOutput) GetUpdatedAt() time.Time {
+	return ao.UpdatedAt
+}
+
+func (ao AWeberOutput) MarshalJSON() ([]byte, error) {
+	type aweberOutput AWeberOutput
+	return marshalOutput(ao.OutputName(), aweberOutput(ao))
+}
+
+func (ao AWeberOutput) Handle(subscriber Subscriber) (int, error) {
 	formData := url.Values{}
 
 	formData.Set(FormFieldListName, ao.ListID)
-	formData.Set(FormFieldName, name)
-	formData.Set(FormFieldEmail, emailAddr)
+	formData.Set(FormFieldName, subscriber.Name)
+	formData.Set(FormFieldEmail, subscriber.EmailAddr)
 	if ao.AdTracking != "" {
 		formData.Set(FormFieldAdTracking, ao.AdTracking)
 	}
@@ -122,119 +221,517 @@ func (ao AWeberOutput) Handle(emailAddr string, name string) error {
 		bytes.NewBufferString(encodedFormData),
 	)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	req.Header.Add(HTTPHeaderAcceptEncoding, ContentTypeApplicationXwwwFormUrlEncoded)
 	req.Header.Add(HTTPHeaderContentType, ContentTypeApplicationXwwwFormUrlEncoded)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := outputHTTPClient.Do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode >= 300 {
-		return fmt.Errorf("received %d status code", resp.StatusCode)
+		return resp.StatusCode, &StatusCodeError{StatusCode: resp.StatusCode}
 	}
 
-	return nil
+	return resp.StatusCode, nil
 }
 
 func (bo BrevoOutput) OutputName() OutputName {
 	return OutputNameBrevo
 }
 
+func (bo BrevoOutput) GetID() string {
+	return bo.ID
+}
+
 func (bo BrevoOutput) GetUserID() string {
 	return bo.UserID
 }
 
-func (bo BrevoOutput) Handle(emailAddr string, name string) error {
-	brevoApiKey := os.Getenv(EnvBrevoApiKey)
+func (bo BrevoOutput) GetCreatedAt() time.Time {
+	return bo.CreatedAt
+}
+
+func (bo BrevoOutput) GetUpdatedAt() time.Time {
+	return bo.UpdatedAt
+}
+
+func (bo BrevoOutput) MarshalJSON() ([]byte, error) {
+	type brevoOutput BrevoOutput
+	return marshalOutput(bo.OutputName(), brevoOutput(bo))
+}
+
+func (bo BrevoOutput) Handle(subscriber Subscriber) (int, error) {
+	brevoApiKey := fallbackIfEmpty(bo.ApiKey, os.Getenv(EnvBrevoApiKey))
 	if brevoApiKey == "" {
-		return missingEnv(EnvBrevoApiKey)
+		return 0, missingCredential("apiKey", EnvBrevoApiKey)
 	}
 
 	cfg := sendinblue.NewConfiguration()
 	cfg.AddDefaultHeader("api-key", brevoApiKey)
+	cfg.HTTPClient = outputHTTPClient
 
 	if bo.ListID == "" {
-		return fmt.Errorf("listID cannot be empty")
+		return 0, fmt.Errorf("listID cannot be empty")
 	}
 	i, err := strconv.Atoi(bo.ListID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	listID := int64(i)
 
 	sib := sendinblue.NewAPIClient(cfg)
 
+	firstName, lastName := subscriber.FirstAndLastName()
+
 	contact := sendinblue.CreateContact{
-		Email: emailAddr,
+		Email: subscriber.EmailAddr,
 		Attributes: map[string]interface{}{
-			"FIRSTNAME": name,
+			"FIRSTNAME": firstName,
+			"LASTNAME":  lastName,
 		},
 		ListIds: []int64{
 			listID,
 		},
+		// Subscribers can join more than one list, so they may already be a Brevo contact
+		UpdateEnabled: true,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), outputRequestTimeout)
+	defer cancel()
+
+	_, resp, err := sib.ContactsApi.CreateContact(ctx, contact)
+	if resp == nil {
+		return 0, err
+	}
+	if err != nil {
+		return resp.StatusCode, &StatusCodeError{StatusCode: resp.StatusCode, Err: err}
+	}
+	return resp.StatusCode, nil
+}
+
+func (co ConvertKitOutput) OutputName() OutputName {
+	return OutputNameConvertKit
+}
+
+func (co ConvertKitOutput) GetID() string {
+	return co.ID
+}
+
+func (co ConvertKitOutput) GetUserID() string {
+	return co.UserID
+}
+
+func (co ConvertKitOutput) GetCreatedAt() time.Time {
+	return co.CreatedAt
+}
+
+func (co ConvertKitOutput) GetUpdatedAt() time.Time {
+	return co.UpdatedAt
+}
+
+func (co ConvertKitOutput) MarshalJSON() ([]byte, error) {
+	type convertKitOutput ConvertKitOutput
+	return marshalOutput(co.OutputName(), convertKitOutput(co))
+}
+
+var convertKitApiUrl = "https://api.convertkit.com/v3"
+
+// Handle subscribes the subscriber to the form and then the tag, whichever of the two are set
+func (co ConvertKitOutput) Handle(subscriber Subscriber) (int, error) {
+	if co.ApiKey == "" {
+		return 0, fmt.Errorf("apiKey cannot be empty")
+	}
+	if co.FormID == "" && co.TagID == "" {
+		return 0, fmt.Errorf("formID and tagID cannot both be empty")
+	}
+
+	firstName, _ := subscriber.FirstAndLastName()
+
+	payload := ConvertKitSubscribeReq{
+		ApiKey:    co.ApiKey,
+		Email:     subscriber.EmailAddr,
+		FirstName: firstName,
+	}
+
+	var (
+		statusCode int
+		err        error
+	)
+	if co.FormID != "" {
+		if statusCode, err = convertKitSubscribe("/forms/"+url.PathEscape(co.FormID)+"/subscribe", payload); err != nil {
+			return statusCode, err
+		}
+	}
+	if co.TagID != "" {
+		return convertKitSubscribe("/tags/"+url.PathEscape(co.TagID)+"/subscribe", payload)
+	}
+	return statusCode, nil
+}
+
+func convertKitSubscribe(path string, payload ConvertKitSubscribeReq) (int, error) {
+	req, err := newOutputJSONRequest(http.MethodPost, convertKitApiUrl+path, payload)
+	if err != nil {
+		return 0, err
+	}
+	return doOutputRequest(req, "convertkit")
+}
+
+func (do DiscordOutput) OutputName() OutputName {
+	return OutputNameDiscord
+}
+
+func (do DiscordOutput) GetID() string {
+	return do.ID
+}
+
+func (do DiscordOutput) GetUserID() string {
+	return do.UserID
+}
+
+func (do DiscordOutput) GetCreatedAt() time.Time {
+	return do.CreatedAt
+}
+
+func (do DiscordOutput) GetUpdatedAt() time.Time {
+	return do.UpdatedAt
+}
+
+func (do DiscordOutput) MarshalJSON() ([]byte, error) {
+	type discordOutput DiscordOutput
+	return marshalOutput(do.OutputName(), discordOutput(do))
+}
+
+func (do DiscordOutput) StripolMap(subscriber Subscriber) map[string]string {
+	return subscriberStripolMap(subscriber)
+}
+
+func (do DiscordOutput) Handle(subscriber Subscriber) (int, error) {
+	if do.WebhookUrl == "" {
+		return 0, fmt.Errorf("webhookUrl cannot be empty")
+	}
+
+	vars := do.StripolMap(subscriber)
+
+	embeds, err := evalJSONTemplate(do.Embeds, vars)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := newOutputJSONRequest(http.MethodPost, do.WebhookUrl, DiscordMessageReq{
+		Content:         truncateRunes(evalTemplate(do.MsgFmt, vars), discordMaxContentLength),
+		Embeds:          embeds,
+		AllowedMentions: DiscordAllowedMentions{Parse: []string{}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return doOutputRequest(req, "discord")
+}
+
+func (mo MailchimpOutput) OutputName() OutputName {
+	return OutputNameMailchimp
+}
+
+func (mo MailchimpOutput) GetID() string {
+	return mo.ID
+}
+
+func (mo MailchimpOutput) GetUserID() string {
+	return mo.UserID
+}
+
+func (mo MailchimpOutput) GetCreatedAt() time.Time {
+	return mo.CreatedAt
+}
+
+func (mo MailchimpOutput) GetUpdatedAt() time.Time {
+	return mo.UpdatedAt
+}
+
+func (mo MailchimpOutput) MarshalJSON() ([]byte, error) {
+	type mailchimpOutput MailchimpOutput
+	return marshalOutput(mo.OutputName(), mailchimpOutput(mo))
+}
+
+// mailchimpApiUrlFmt is filled in with the data center of the API key
+var mailchimpApiUrlFmt = "https://%s.api.mailchimp.com/3.0"
+
+// Handle upserts the subscriber as a member of the audience, so that subscribers
+// who are already members have their merge fields updated instead of failing
+func (mo MailchimpOutput) Handle(subscriber Subscriber) (int, error) {
+	mailchimpApiKey := fallbackIfEmpty(mo.ApiKey, os.Getenv(EnvMailchimpApiKey))
+	if mailchimpApiKey == "" {
+		return 0, missingCredential("apiKey", EnvMailchimpApiKey)
+	}
+
+	dc, err := mailchimpDataCenter(mailchimpApiKey)
+	if err != nil {
+		return 0, err
+	}
+
+	if mo.AudienceID == "" {
+		return 0, fmt.Errorf("audienceID cannot be empty")
+	}
+
+	firstName, lastName := subscriber.FirstAndLastName()
+
+	memberUrl := fmt.Sprintf(mailchimpApiUrlFmt, dc) +
+		"/lists/" + url.PathEscape(mo.AudienceID) +
+		"/members/" + mailchimpSubscriberHash(subscriber.EmailAddr)
+
+	member := MailchimpMemberReq{
+		EmailAddress: subscriber.EmailAddr,
+		StatusIfNew:  MailchimpMemberStatus(fallbackIfEmpty(string(mo.Status), string(MailchimpMemberStatusSubscribed))),
+		MergeFields: map[string]string{
+			"FNAME": firstName,
+			"LNAME": lastName,
+		},
+	}
+	statusCode, err := mailchimpRequest(http.MethodPut, memberUrl, mailchimpApiKey, member)
+	if err != nil || len(mo.Tags) == 0 {
+		return statusCode, err
+	}
+
+	tags := MailchimpTagsReq{}
+	for _, tag := range mo.Tags {
+		tags.Tags = append(tags.Tags, MailchimpTag{Name: tag, Status: "active"})
+	}
+	return mailchimpRequest(http.MethodPost, memberUrl+"/tags", mailchimpApiKey, tags)
+}
+
+func mailchimpRequest(method string, _url string, apiKey string, payload any) (int, error) {
+	req, err := newOutputJSONRequest(method, _url, payload)
+	if err != nil {
+		return 0, err
+	}
+	// Mailchimp accepts any username, as long as the password is the API key
+	req.SetBasicAuth("anystring", apiKey)
+	return doOutputRequest(req, "mailchimp")
+}
+
+// mailchimpDataCenter returns the data center of the account, which is
+// the suffix of the API key, such as "us21" in "0123456789abcdef-us21"
+func mailchimpDataCenter(apiKey string) (string, error) {
+	i := strings.LastIndex(apiKey, "-")
+	if i == -1 || i == len(apiKey)-1 {
+		return "", fmt.Errorf("mailchimp API key is missing the data center suffix")
+	}
+	return apiKey[i+1:], nil
+}
+
+// mailchimpSubscriberHash is how Mailchimp identifies a member in URLs
+func mailchimpSubscriberHash(emailAddr string) string {
+	sum := md5.Sum([]byte(strings.ToLower(emailAddr)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (mo MailerLiteOutput) OutputName() OutputName {
+	return OutputNameMailerLite
+}
+
+func (mo MailerLiteOutput) GetID() string {
+	return mo.ID
+}
+
+func (mo MailerLiteOutput) GetUserID() string {
+	return mo.UserID
+}
+
+func (mo MailerLiteOutput) GetCreatedAt() time.Time {
+	return mo.CreatedAt
+}
+
+func (mo MailerLiteOutput) GetUpdatedAt() time.Time {
+	return mo.UpdatedAt
+}
+
+func (mo MailerLiteOutput) MarshalJSON() ([]byte, error) {
+	type mailerLiteOutput MailerLiteOutput
+	return marshalOutput(mo.OutputName(), mailerLiteOutput(mo))
+}
+
+var mailerLiteApiUrl = "https://connect.mailerlite.com/api"
+
+// Handle upserts the subscriber, which adds them to the group
+// without removing them from any groups they are already in
+func (mo MailerLiteOutput) Handle(subscriber Subscriber) (int, error) {
+	if mo.ApiKey == "" {
+		return 0, fmt.Errorf("apiKey cannot be empty")
+	}
+	if mo.GroupID == "" {
+		return 0, fmt.Errorf("groupID cannot be empty")
 	}
 
-	_, _, err = sib.ContactsApi.CreateContact(context.Background(), contact)
-	return err
+	firstName, lastName := subscriber.FirstAndLastName()
+
+	req, err := newOutputJSONRequest(http.MethodPost, mailerLiteApiUrl+"/subscribers", MailerLiteSubscriberReq{
+		Email: subscriber.EmailAddr,
+		Fields: map[string]string{
+			"name":      firstName,
+			"last_name": lastName,
+		},
+		Groups: []string{mo.GroupID},
+	})
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set(HTTPHeaderAuthorization, "Bearer "+mo.ApiKey)
+	return doOutputRequest(req, "mailerlite")
 }
 
 func (ro ResendOutput) OutputName() OutputName {
 	return OutputNameResend
 }
 
+func (ro ResendOutput) GetID() string {
+	return ro.ID
+}
+
 func (ro ResendOutput) GetUserID() string {
 	return ro.UserID
 }
 
-func (ro ResendOutput) Handle(emailAddr string, name string) error {
-	resendApiKey := os.Getenv(EnvResendApiKey)
+func (ro ResendOutput) GetCreatedAt() time.Time {
+	return ro.CreatedAt
+}
+
+func (ro ResendOutput) GetUpdatedAt() time.Time {
+	return ro.UpdatedAt
+}
+
+func (ro ResendOutput) MarshalJSON() ([]byte, error) {
+	type resendOutput ResendOutput
+	return marshalOutput(ro.OutputName(), resendOutput(ro))
+}
+
+func (ro ResendOutput) Handle(subscriber Subscriber) (int, error) {
+	resendApiKey := fallbackIfEmpty(ro.ApiKey, os.Getenv(EnvResendApiKey))
 	if resendApiKey == "" {
-		return missingEnv(EnvResendApiKey)
+		return 0, missingCredential("apiKey", EnvResendApiKey)
 	}
 
-	client := resend.NewClient(resendApiKey)
+	// The SDK doesn't return the status code, so it is read off the transport
+	recorder := &statusRecorder{}
+	client := resend.NewCustomClient(&http.Client{Timeout: outputRequestTimeout, Transport: recorder}, resendApiKey)
+
+	firstName, lastName := subscriber.FirstAndLastName()
 
 	params := &resend.CreateContactRequest{
-		Email:        emailAddr,
-		FirstName:    name,
-		LastName:     "",
+		Email:        subscriber.EmailAddr,
+		FirstName:    firstName,
+		LastName:     lastName,
 		Unsubscribed: false,
 		AudienceId:   ro.AudienceID,
 	}
 	_, err := client.Contacts.Create(params)
-	return err
+	return recorder.statusCode, err
+}
+
+func (so SlackOutput) OutputName() OutputName {
+	return OutputNameSlack
+}
+
+func (so SlackOutput) GetID() string {
+	return so.ID
+}
+
+func (so SlackOutput) GetUserID() string {
+	return so.UserID
+}
+
+func (so SlackOutput) GetCreatedAt() time.Time {
+	return so.CreatedAt
+}
+
+func (so SlackOutput) GetUpdatedAt() time.Time {
+	return so.UpdatedAt
+}
+
+func (so SlackOutput) MarshalJSON() ([]byte, error) {
+	type slackOutput SlackOutput
+	return marshalOutput(so.OutputName(), slackOutput(so))
+}
+
+// StripolMap returns the subscriber's values escaped for Slack, so that
+// a name such as "<!channel>" is shown as is, rather than notifying everyone
+func (so SlackOutput) StripolMap(subscriber Subscriber) map[string]string {
+	m := subscriberStripolMap(subscriber)
+	for k, v := range m {
+		m[k] = slackEscaper.Replace(v)
+	}
+	return m
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (so SlackOutput) Handle(subscriber Subscriber) (int, error) {
+	if so.WebhookUrl == "" {
+		return 0, fmt.Errorf("webhookUrl cannot be empty")
+	}
+
+	vars := so.StripolMap(subscriber)
+
+	blocks, err := evalJSONTemplate(so.Blocks, vars)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := newOutputJSONRequest(http.MethodPost, so.WebhookUrl, SlackMessageReq{
+		Text:   evalTemplate(so.MsgFmt, vars),
+		Blocks: blocks,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return doOutputRequest(req, "slack")
 }
 
 func (to TelegramOutput) OutputName() OutputName {
 	return OutputNameTelegram
 }
 
+func (to TelegramOutput) GetID() string {
+	return to.ID
+}
+
 func (to TelegramOutput) GetUserID() string {
 	return to.UserID
 }
 
-func (to TelegramOutput) StripolMap(emailAddr string, name string) map[string]string {
-	return emailAddrAndNameStripolMap(emailAddr, name)
+func (to TelegramOutput) GetCreatedAt() time.Time {
+	return to.CreatedAt
+}
+
+func (to TelegramOutput) GetUpdatedAt() time.Time {
+	return to.UpdatedAt
+}
+
+func (to TelegramOutput) MarshalJSON() ([]byte, error) {
+	type telegramOutput TelegramOutput
+	return marshalOutput(to.OutputName(), telegramOutput(to))
+}
+
+func (to TelegramOutput) StripolMap(subscriber Subscriber) map[string]string {
+	return subscriberStripolMap(subscriber)
 }
 
-func (to TelegramOutput) Handle(emailAddr string, name string) error {
-	telegramBotID := os.Getenv(EnvTelegramBotID)
+func (to TelegramOutput) Handle(subscriber Subscriber) (int, error) {
+	telegramBotID := fallbackIfEmpty(to.BotID, os.Getenv(EnvTelegramBotID))
 	if telegramBotID == "" {
-		return missingEnv(EnvTelegramBotID)
+		return 0, missingCredential("botId", EnvTelegramBotID)
 	}
 
-	si := stripol.New(stripolLeftDelim, stripolRightDelim)
-	si.RegisterVars(to.StripolMap(emailAddr, name))
-	msg := si.Eval(to.MsgFmt)
+	msg := evalTemplate(to.MsgFmt, to.StripolMap(subscriber))
 
 	return SendMessageToTelegramChannel(telegramBotID, to.ChatID, msg)
 }
 
-func SendMessageToTelegramChannel(botID string, chatId string, message string) error {
+func SendMessageToTelegramChannel(botID string, chatId string, message string) (int, error) {
 	fdm := make(FormDataMap)
 	fdm[FormFieldTelegramChatID] = strings.NewReader(chatId)
 	fdm[FormFieldText] = strings.NewReader(message)
@@ -245,26 +742,218 @@ func (wo WebhookOutput) OutputName() OutputName {
 	return OutputNameWebhook
 }
 
+func (wo WebhookOutput) GetID() string {
+	return wo.ID
+}
+
 func (wo WebhookOutput) GetUserID() string {
 	return wo.UserID
 }
 
-func (wo WebhookOutput) StripolMap(emailAddr string, name string) map[string]string {
-	return emailAddrAndNameStripolMap(emailAddr, name)
+func (wo WebhookOutput) GetCreatedAt() time.Time {
+	return wo.CreatedAt
+}
+
+func (wo WebhookOutput) GetUpdatedAt() time.Time {
+	return wo.UpdatedAt
 }
 
-func (wo WebhookOutput) Handle(emailAddr string, name string) error {
+func (wo WebhookOutput) MarshalJSON() ([]byte, error) {
+	type webhookOutput WebhookOutput
+	return marshalOutput(wo.OutputName(), webhookOutput(wo))
+}
+
+// StripolMap returns the subscriber's values query escaped, since they are substituted into a URL
+func (wo WebhookOutput) StripolMap(subscriber Subscriber) map[string]string {
+	m := subscriberStripolMap(subscriber)
+	for k, v := range m {
+		m[k] = url.QueryEscape(v)
+	}
+	return m
+}
+
+var webhookMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch}
+
+// outputHTTPClient is used for every call to a third-party API, so that a hung call fails
+// well before outboxProcessingStale, instead of its job being claimed and delivered twice
+var outputHTTPClient = &http.Client{Timeout: outputRequestTimeout}
+
+// statusRecorder is a transport that remembers the status code of the last response
+// it carried, for SDKs that don't hand it back to the caller
+type statusRecorder struct {
+	statusCode int
+}
+
+func (sr *statusRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if resp != nil {
+		sr.statusCode = resp.StatusCode
+	}
+	return resp, err
+}
+
+func (wo WebhookOutput) Handle(subscriber Subscriber) (int, error) {
+	_url := evalTemplate(wo.UrlFmt, wo.StripolMap(subscriber))
+
+	now := time.Now()
+	method := fallbackIfEmpty(wo.Method, http.MethodGet)
+
+	var body []byte
+	if method != http.MethodGet {
+		event, err := NewWebhookEvent(subscriber, now)
+		if err != nil {
+			return 0, err
+		}
+		if body, err = json.Marshal(event); err != nil {
+			return 0, err
+		}
+	}
+
+	req, err := http.NewRequest(method, _url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range wo.Headers {
+		req.Header.Set(k, v)
+	}
+	if body != nil && req.Header.Get(HTTPHeaderContentType) == "" {
+		req.Header.Set(HTTPHeaderContentType, ContentTypeApplicationJson)
+	}
+	if wo.Secret != "" {
+		req.Header.Set(HTTPHeaderWebhookTimestamp, strconv.FormatInt(now.Unix(), 10))
+		req.Header.Set(HTTPHeaderWebhookSignature, signWebhook(wo.Secret, now.Unix(), body))
+	}
+
+	resp, err := outputHTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Reading what is left of the body lets the connection be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, &StatusCodeError{StatusCode: resp.StatusCode}
+	}
+	return resp.StatusCode, nil
+}
+
+func NewWebhookEvent(subscriber Subscriber, timestamp time.Time) (*WebhookEvent, error) {
+	event := &WebhookEvent{
+		Type:       WebhookEventTypeSubscriberAdded,
+		Timestamp:  timestamp,
+		Provider:   subscriber.SourceProviderName,
+		Subscriber: subscriber,
+	}
+
+	if subscriber.EmailListID != "" {
+		emailList, err := storage.GetEmailListByID(subscriber.EmailListID)
+		if err != nil {
+			return nil, err
+		}
+		event.EmailList = emailList
+	}
+
+	return event, nil
+}
+
+// signWebhook returns the HMAC-SHA256 of the timestamp and body, joined by a dot.
+// Signing the timestamp lets receivers reject requests that are replayed later on.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newOutputJSONRequest makes a request to a third-party API with the payload as its JSON body
+func newOutputJSONRequest(method string, _url string, payload any) (*http.Request, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, _url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(HTTPHeaderContentType, ContentTypeApplicationJson)
+	req.Header.Set(HTTPHeaderAccept, ContentTypeApplicationJson)
+	return req, nil
+}
+
+// doOutputRequest sends a request to a third-party API, and returns a StatusCodeError
+// holding the reason the API gives when it responds with a non-2xx status code
+func doOutputRequest(req *http.Request, apiName string) (int, error) {
+	resp, err := outputHTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		sce := &StatusCodeError{StatusCode: resp.StatusCode}
+		var errResp OutputApiErrorResp
+		json.NewDecoder(io.LimitReader(resp.Body, maxDrainBytes)).Decode(&errResp)
+		reason := fallbackIfEmpty(errResp.Detail, fallbackIfEmpty(errResp.Message, fallbackIfEmpty(errResp.Error, errResp.Title)))
+		if reason != "" {
+			sce.Err = fmt.Errorf("%s responded with %d: %s", apiName, resp.StatusCode, reason)
+		}
+		return resp.StatusCode, sce
+	}
+
+	// Reading what is left of the body lets the connection be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	return resp.StatusCode, nil
+}
+
+func evalTemplate(tmpl string, vars map[string]string) string {
 	si := stripol.New(stripolLeftDelim, stripolRightDelim)
-	si.RegisterVars(wo.StripolMap(url.QueryEscape(emailAddr), url.QueryEscape(name)))
-	_url := si.Eval(wo.UrlFmt)
+	si.RegisterVars(vars)
+	return si.Eval(tmpl)
+}
+
+// evalJSONTemplate substitutes the variables into every string of a JSON template. Only the strings
+// are evaluated, so that values with quotes can't break the JSON, and so that the closing braces
+// of nested objects aren't taken for template delimiters.
+func evalJSONTemplate(tmpl json.RawMessage, vars map[string]string) (json.RawMessage, error) {
+	if len(tmpl) == 0 {
+		return nil, nil
+	}
+
+	var v any
+	d := json.NewDecoder(bytes.NewReader(tmpl))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(evalTemplateStrings(v, vars))
+}
 
-	_, err := http.Get(_url)
-	return err
+func evalTemplateStrings(v any, vars map[string]string) any {
+	switch t := v.(type) {
+	case string:
+		return evalTemplate(t, vars)
+	case []any:
+		for i, item := range t {
+			t[i] = evalTemplateStrings(item, vars)
+		}
+	case map[string]any:
+		for k, item := range t {
+			t[k] = evalTemplateStrings(item, vars)
+		}
+	}
+	return v
 }
 
-func emailAddrAndNameStripolMap(emailAddr string, name string) map[string]string {
+func subscriberStripolMap(subscriber Subscriber) map[string]string {
 	return map[string]string{
-		StrIpolEmailAddr: emailAddr,
-		StrIpolName:      name,
+		StrIpolEmailAddr:  subscriber.EmailAddr,
+		StrIpolFamilyName: subscriber.FamilyName,
+		StrIpolGivenName:  subscriber.GivenName,
+		StrIpolName:       subscriber.Name,
 	}
 }
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignWebhook(t *testing.T) {
+	// echo -n '1700000000.{}' | openssl dgst -sha256 -hmac 'whsec_0123456789abcdef'
+	assert.Equal(
+		t,
+		"sha256=d0c329a0542d1a8e66b0b5503cf2d2f8f8e174c98224b843c11f74ea14c341e9",
+		signWebhook("whsec_0123456789abcdef", 1700000000, []byte("{}")),
+	)
+}
+
+func TestWebhookOutputHandle(t *testing.T) {
+	const secret = "whsec_0123456789abcdef"
+
+	var (
+		status = http.StatusOK
+		got    *http.Request
+		body   []byte
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	wo := WebhookOutput{WebhookOutputConfig: WebhookOutputConfig{
+		UrlFmt:  ts.URL + "?email={{emailAddr}}",
+		Method:  http.MethodPost,
+		Headers: map[string]string{"X-Api-Key": "abc"},
+		Secret:  secret,
+	}}
+	subscriber := Subscriber{ID: "1", Name: "Tom Jones", EmailAddr: "tom+1@domain.com", SourceProviderName: ProviderNameGoogle}
+
+	statusCode, err := wo.Handle(subscriber)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, http.MethodPost, got.Method)
+	assert.Equal(t, "tom+1@domain.com", got.URL.Query().Get("email"))
+	assert.Equal(t, "abc", got.Header.Get("X-Api-Key"))
+	assert.Equal(t, ContentTypeApplicationJson, got.Header.Get(HTTPHeaderContentType))
+
+	var event WebhookEvent
+	assert.Nil(t, json.Unmarshal(body, &event))
+	assert.Equal(t, WebhookEventTypeSubscriberAdded, event.Type)
+	assert.Equal(t, ProviderNameGoogle, event.Provider)
+	assert.Equal(t, "tom+1@domain.com", event.Subscriber.EmailAddr)
+	assert.Nil(t, event.EmailList)
+
+	timestamp, err := strconv.ParseInt(got.Header.Get(HTTPHeaderWebhookTimestamp), 10, 64)
+	assert.Nil(t, err)
+	assert.Equal(t, event.Timestamp.Unix(), timestamp)
+	assert.Equal(t, signWebhook(secret, timestamp, body), got.Header.Get(HTTPHeaderWebhookSignature))
+
+	status = http.StatusGone
+	statusCode, err = wo.Handle(subscriber)
+	assert.Equal(t, http.StatusGone, statusCode)
+	assert.Equal(t, http.StatusGone, statusCodeOf(err))
+
+	// GET requests, the default, have no body
+	status = http.StatusOK
+	wo.Method = ""
+	_, err = wo.Handle(subscriber)
+	assert.Nil(t, err)
+	assert.Equal(t, http.MethodGet, got.Method)
+	assert.Empty(t, body)
+}
+
+func TestMailchimpDataCenter(t *testing.T) {
+	dc, err := mailchimpDataCenter("0123456789abcdef-us21")
+	assert.Nil(t, err)
+	assert.Equal(t, "us21", dc)
+
+	_, err = mailchimpDataCenter("0123456789abcdef")
+	assert.NotNil(t, err)
+	_, err = mailchimpDataCenter("0123456789abcdef-")
+	assert.NotNil(t, err)
+}
+
+func TestMailchimpOutputHandle(t *testing.T) {
+	var (
+		status = http.StatusOK
+		paths  []string
+		bodies []map[string]any
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, password, _ := r.BasicAuth()
+		assert.Equal(t, "0123456789abcdef-us21", password)
+
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			w.Write([]byte(`{"title":"Invalid Resource","detail":"Please provide a valid email address."}`))
+		}
+	}))
+	defer ts.Close()
+
+	t.Setenv(EnvMailchimpApiKey, "0123456789abcdef-us21")
+	defer func(urlFmt string) { mailchimpApiUrlFmt = urlFmt }(mailchimpApiUrlFmt)
+	mailchimpApiUrlFmt = ts.URL + "/%s/3.0"
+
+	mo := MailchimpOutput{MailchimpOutputConfig: MailchimpOutputConfig{
+		AudienceID: "a1b2c3d4e5",
+		Status:     MailchimpMemberStatusPending,
+		Tags:       []string{"oauth"},
+	}}
+	subscriber := Subscriber{Name: "Tom Jones", GivenName: "Tom", FamilyName: "Jones", EmailAddr: "Tom@Domain.com"}
+
+	// echo -n 'tom@domain.com' | md5sum
+	memberPath := "/us21/3.0/lists/a1b2c3d4e5/members/f2bc6f07123068f0af3b61676635533b"
+
+	_, err := mo.Handle(subscriber)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"PUT " + memberPath, "POST " + memberPath + "/tags"}, paths)
+	assert.Equal(t, "pending", bodies[0]["status_if_new"])
+	assert.Equal(t, map[string]any{"FNAME": "Tom", "LNAME": "Jones"}, bodies[0]["merge_fields"])
+	assert.Equal(t, []any{map[string]any{"name": "oauth", "status": "active"}}, bodies[1]["tags"])
+
+	status = http.StatusBadRequest
+	_, err = mo.Handle(subscriber)
+	assert.Equal(t, http.StatusBadRequest, statusCodeOf(err))
+	assert.Contains(t, err.Error(), "Please provide a valid email address.")
+}
+
+func TestConvertKitOutputHandle(t *testing.T) {
+	var (
+		paths  []string
+		bodies []ConvertKitSubscribeReq
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		var body ConvertKitSubscribeReq
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+
+		if r.URL.Path == "/v3/tags/456/subscribe" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"Not Found","message":"Tag not found"}`))
+		}
+	}))
+	defer ts.Close()
+
+	defer func(apiUrl string) { convertKitApiUrl = apiUrl }(convertKitApiUrl)
+	convertKitApiUrl = ts.URL + "/v3"
+
+	co := ConvertKitOutput{ConvertKitOutputConfig: ConvertKitOutputConfig{ApiKey: "ck_key", FormID: "123"}}
+	subscriber := Subscriber{Name: "Tom Jones", GivenName: "Tom", FamilyName: "Jones", EmailAddr: "tom@domain.com"}
+
+	_, err := co.Handle(subscriber)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"POST /v3/forms/123/subscribe"}, paths)
+	assert.Equal(t, ConvertKitSubscribeReq{ApiKey: "ck_key", Email: "tom@domain.com", FirstName: "Tom"}, bodies[0])
+
+	co.TagID = "456"
+	_, err = co.Handle(subscriber)
+	assert.Equal(t, http.StatusNotFound, statusCodeOf(err))
+	assert.Equal(t, "convertkit responded with 404: Tag not found", err.Error())
+}
+
+func TestMailerLiteOutputHandle(t *testing.T) {
+	var (
+		got  *http.Request
+		body MailerLiteSubscriberReq
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	defer func(apiUrl string) { mailerLiteApiUrl = apiUrl }(mailerLiteApiUrl)
+	mailerLiteApiUrl = ts.URL + "/api"
+
+	mo := MailerLiteOutput{MailerLiteOutputConfig: MailerLiteOutputConfig{ApiKey: "ml_key", GroupID: "98765"}}
+	subscriber := Subscriber{Name: "Tom Jones", GivenName: "Tom", FamilyName: "Jones", EmailAddr: "tom@domain.com"}
+
+	statusCode, err := mo.Handle(subscriber)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, statusCode)
+	assert.Equal(t, "/api/subscribers", got.URL.Path)
+	assert.Equal(t, "Bearer ml_key", got.Header.Get(HTTPHeaderAuthorization))
+	assert.Equal(t, "tom@domain.com", body.Email)
+	assert.Equal(t, map[string]string{"name": "Tom", "last_name": "Jones"}, body.Fields)
+	assert.Equal(t, []string{"98765"}, body.Groups)
+}
+
+func TestEvalJSONTemplate(t *testing.T) {
+	vars := map[string]string{StrIpolName: `Tom "TJ" Jones` + "\n"}
+
+	result, err := evalJSONTemplate(json.RawMessage(`[{"text": {"text": "{{name}} subscribed"}, "color": 5814783}]`), vars)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `[{"text": {"text": "Tom \"TJ\" Jones\n subscribed"}, "color": 5814783}]`, string(result))
+
+	result, err = evalJSONTemplate(nil, vars)
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+}
+
+func TestSlackOutputHandle(t *testing.T) {
+	var body SlackMessageReq
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer ts.Close()
+
+	so := SlackOutput{SlackOutputConfig: SlackOutputConfig{
+		WebhookUrl: ts.URL,
+		MsgFmt:     "New subscriber: {{name}}",
+		Blocks:     json.RawMessage(`[{"type": "section", "text": {"type": "mrkdwn", "text": "*{{name}}* <mailto:{{emailAddr}}|{{emailAddr}}>"}}]`),
+	}}
+	subscriber := Subscriber{Name: "<!channel> & co", EmailAddr: "tom@domain.com"}
+
+	_, err := so.Handle(subscriber)
+	assert.Nil(t, err)
+	assert.Equal(t, "New subscriber: &lt;!channel&gt; &amp; co", body.Text)
+	assert.JSONEq(
+		t,
+		`[{"type": "section", "text": {"type": "mrkdwn", "text": "*&lt;!channel&gt; &amp; co* <mailto:tom@domain.com|tom@domain.com>"}}]`,
+		string(body.Blocks),
+	)
+}
+
+func TestDiscordOutputHandle(t *testing.T) {
+	var body map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	do := DiscordOutput{DiscordOutputConfig: DiscordOutputConfig{
+		WebhookUrl: ts.URL,
+		MsgFmt:     "New subscriber: {{name}}",
+		Embeds:     json.RawMessage(`[{"title": "{{name}}", "description": "{{emailAddr}}"}]`),
+	}}
+	subscriber := Subscriber{Name: "@everyone", EmailAddr: "tom@domain.com"}
+
+	statusCode, err := do.Handle(subscriber)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, statusCode)
+	assert.Equal(t, "New subscriber: @everyone", body["content"])
+	assert.Equal(t, []any{map[string]any{"title": "@everyone", "description": "tom@domain.com"}}, body["embeds"])
+	assert.Equal(t, map[string]any{"parse": []any{}}, body["allowed_mentions"])
+}
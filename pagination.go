@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cursorTimeLayout matches how postgres prints a timestamp without a time zone,
+// so a cursor value can be cast straight back with ::timestamp
+const cursorTimeLayout = "2006-01-02 15:04:05.999999"
+
+// pageSortColumn is the SQL expression behind a sort key that can be passed in the sort query param
+type pageSortColumn struct {
+	expr   string
+	isTime bool
+}
+
+var (
+	createdAtSortColumn = pageSortColumn{expr: "created_at", isTime: true}
+	updatedAtSortColumn = pageSortColumn{expr: "updated_at", isTime: true}
+	nameSortColumn      = pageSortColumn{expr: "coalesce(name, '')"}
+)
+
+var emailListSortColumns = map[string]pageSortColumn{
+	SortKeyCreatedAt: createdAtSortColumn,
+	SortKeyUpdatedAt: updatedAtSortColumn,
+	SortKeyName:      nameSortColumn,
+}
+
+var outputSortColumns = map[string]pageSortColumn{
+	SortKeyCreatedAt: createdAtSortColumn,
+	SortKeyUpdatedAt: updatedAtSortColumn,
+}
+
+var subscriberSortColumns = map[string]pageSortColumn{
+	SortKeyCreatedAt: createdAtSortColumn,
+	SortKeyUpdatedAt: updatedAtSortColumn,
+	SortKeyName:      nameSortColumn,
+	SortKeyEmailAddr: {expr: "email_addr"},
+}
+
+var userSortColumns = map[string]pageSortColumn{
+	SortKeyCreatedAt: createdAtSortColumn,
+	SortKeyUpdatedAt: updatedAtSortColumn,
+	SortKeyName:      nameSortColumn,
+}
+
+// Deliveries, joins, outbox jobs and provider failures are records of
+// something that happened, so they are only sorted by when it happened
+var createdAtSortColumns = map[string]pageSortColumn{
+	SortKeyCreatedAt: createdAtSortColumn,
+}
+
+// ParsePage reads the limit, cursor and sort query params. sort is one of the keys of
+// sortColumns, prefixed with "-" for descending order, and defaults to defaultSort.
+func ParsePage(r *http.Request, sortColumns map[string]pageSortColumn, defaultSort string) (Page, error) {
+	page := Page{
+		Limit: defaultPageLimit,
+		Sort:  fallbackIfEmpty(r.URL.Query().Get(QueryParamSort), defaultSort),
+	}
+
+	if limit := r.URL.Query().Get(QueryParamLimit); limit != "" {
+		i, err := strconv.Atoi(limit)
+		if err != nil || i < 1 || i > maxPageLimit {
+			return Page{}, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		page.Limit = i
+	}
+
+	key := strings.TrimPrefix(page.Sort, "-")
+	column, ok := sortColumns[key]
+	if !ok {
+		return Page{}, fmt.Errorf("invalid sort: %s", page.Sort)
+	}
+	page.desc = strings.HasPrefix(page.Sort, "-")
+	page.key = key
+	page.column = column
+
+	if cursor := r.URL.Query().Get(QueryParamCursor); cursor != "" {
+		pc, err := decodePageCursor(cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		// The cursor only makes sense for the ordering it was made from
+		if pc.Sort != page.Sort {
+			return Page{}, fmt.Errorf("cursor was issued for sort %s, not %s", pc.Sort, page.Sort)
+		}
+		page.Cursor = pc
+	}
+
+	return page, nil
+}
+
+// keyset adds the condition that skips past the cursor to conds, and returns
+// the order by and limit clause to end the query with. One row more than the
+// limit is fetched, so that pageResult can tell whether there is a next page.
+func (p Page) keyset(conds []string, args []any) ([]string, []any, string) {
+	var (
+		op  = ">"
+		dir = "asc"
+	)
+	if p.desc {
+		op = "<"
+		dir = "desc"
+	}
+
+	if p.Cursor != nil {
+		cast := ""
+		if p.column.isTime {
+			cast = "::timestamp"
+		}
+		args = append(args, p.Cursor.Value, p.Cursor.ID)
+		conds = append(conds, fmt.Sprintf("(%s, id) %s ($%d%s, $%d)", p.column.expr, op, len(args)-1, cast, len(args)))
+	}
+
+	return conds, args, fmt.Sprintf(" order by %s %s, id %s limit %d", p.column.expr, dir, dir, p.Limit+1)
+}
+
+// pageQuery builds a paged select from base, which should have no where clause of its own
+func (p Page) pageQuery(base string, conds []string, args []any) (string, []any) {
+	conds, args, tail := p.keyset(conds, args)
+	if len(conds) > 0 {
+		base += " where " + strings.Join(conds, " and ")
+	}
+	return base + tail, args
+}
+
+// pageResult trims the extra row fetched by keyset, and returns the cursor
+// for the next page, which is empty on the last page.
+func pageResult[T any](items []T, p Page, cursorOf func(T, string) PageCursor) ([]T, string, error) {
+	if len(items) <= p.Limit {
+		return items, "", nil
+	}
+
+	items = items[:p.Limit]
+	pc := cursorOf(items[len(items)-1], p.key)
+	pc.Sort = p.Sort
+
+	nextCursor, err := pc.encode()
+	return items, nextCursor, err
+}
+
+func newPageCursor(id string, value any) PageCursor {
+	switch v := value.(type) {
+	case time.Time:
+		return PageCursor{ID: id, Value: v.Format(cursorTimeLayout)}
+	default:
+		return PageCursor{ID: id, Value: fmt.Sprint(v)}
+	}
+}
+
+func (pc PageCursor) encode() (string, error) {
+	b, err := json.Marshal(pc)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodePageCursor(cursor string) (*PageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	pc := new(PageCursor)
+	if err := json.Unmarshal(b, pc); err != nil || pc.ID == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return pc, nil
+}
+
+func (el *EmailList) pageCursor(sortKey string) PageCursor {
+	switch sortKey {
+	case SortKeyName:
+		return newPageCursor(el.ID, el.Name)
+	case SortKeyUpdatedAt:
+		return newPageCursor(el.ID, el.UpdatedAt)
+	}
+	return newPageCursor(el.ID, el.CreatedAt)
+}
+
+func outputPageCursor(output Output, sortKey string) PageCursor {
+	if sortKey == SortKeyUpdatedAt {
+		return newPageCursor(output.GetID(), output.GetUpdatedAt())
+	}
+	return newPageCursor(output.GetID(), output.GetCreatedAt())
+}
+
+func (s *Subscriber) pageCursor(sortKey string) PageCursor {
+	switch sortKey {
+	case SortKeyName:
+		return newPageCursor(s.ID, s.Name)
+	case SortKeyEmailAddr:
+		return newPageCursor(s.ID, s.EmailAddr)
+	case SortKeyUpdatedAt:
+		return newPageCursor(s.ID, s.UpdatedAt)
+	}
+	return newPageCursor(s.ID, s.CreatedAt)
+}
+
+func (u *User) pageCursor(sortKey string) PageCursor {
+	switch sortKey {
+	case SortKeyName:
+		return newPageCursor(u.ID, u.Name)
+	case SortKeyUpdatedAt:
+		return newPageCursor(u.ID, u.UpdatedAt)
+	}
+	return newPageCursor(u.ID, u.CreatedAt)
+}
+
+func (d *Delivery) pageCursor(sortKey string) PageCursor {
+	return newPageCursor(d.ID, d.CreatedAt)
+}
+
+func (j *OutboxJob) pageCursor(sortKey string) PageCursor {
+	return newPageCursor(j.ID, j.CreatedAt)
+}
+
+func (f *ProviderFailure) pageCursor(sortKey string) PageCursor {
+	return newPageCursor(f.ID, f.CreatedAt)
+}
+
+func (j *SubscriberJoin) pageCursor(sortKey string) PageCursor {
+	return newPageCursor(j.ID, j.CreatedAt)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePage(t *testing.T) {
+	page, err := ParsePage(httptest.NewRequest("GET", "/subscribers", nil), subscriberSortColumns, "-"+SortKeyCreatedAt)
+	assert.Nil(t, err)
+	assert.Equal(t, defaultPageLimit, page.Limit)
+	assert.True(t, page.desc)
+	assert.Nil(t, page.Cursor)
+
+	for _, target := range []string{
+		"/subscribers?limit=0",
+		"/subscribers?limit=abc",
+		"/subscribers?limit=1001",
+		"/subscribers?sort=password",
+		"/subscribers?cursor=nope",
+	} {
+		_, err := ParsePage(httptest.NewRequest("GET", target, nil), subscriberSortColumns, SortKeyCreatedAt)
+		assert.NotNil(t, err, target)
+	}
+}
+
+func TestPageResult(t *testing.T) {
+	createdAt := time.Date(2024, 8, 22, 20, 26, 6, 874752000, time.UTC)
+	subscribers := []*Subscriber{
+		{ID: "1", CreatedAt: createdAt},
+		{ID: "2", CreatedAt: createdAt},
+		{ID: "3", CreatedAt: createdAt},
+	}
+
+	page, err := ParsePage(httptest.NewRequest("GET", "/subscribers?limit=2", nil), subscriberSortColumns, SortKeyCreatedAt)
+	assert.Nil(t, err)
+
+	items, nextCursor, err := pageResult(subscribers, page, (*Subscriber).pageCursor)
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+	assert.NotEmpty(t, nextCursor)
+
+	page, err = ParsePage(httptest.NewRequest("GET", "/subscribers?limit=2&cursor="+nextCursor, nil), subscriberSortColumns, SortKeyCreatedAt)
+	assert.Nil(t, err)
+	assert.Equal(t, "2", page.Cursor.ID)
+	assert.Equal(t, "2024-08-22 20:26:06.874752", page.Cursor.Value)
+
+	// A cursor can't be reused with a different sort
+	_, err = ParsePage(httptest.NewRequest("GET", "/subscribers?sort=name&cursor="+nextCursor, nil), subscriberSortColumns, SortKeyCreatedAt)
+	assert.NotNil(t, err)
+
+	items, nextCursor, err = pageResult(subscribers[2:], page, (*Subscriber).pageCursor)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Empty(t, nextCursor)
+}
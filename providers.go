@@ -1,56 +1,98 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"html"
+	"log"
 	"net/http"
-	"net/url"
-	"os"
-	"time"
-)
+	"strconv"
+	"strings"
+	"sync"
 
-const (
-	timestampFormat   string = time.UnixDate
-	timestampLayout   string = "Mon Jan 2 15:04:05 CDT 2006"
-	outputCookieDelim string = "---"
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/oauth2"
 )
 
+const redditUserAgent string = "web:oauth-email-lists:v1.0.0"
+
+const outputCookieDelim string = "---"
+
 type OAuthProvider interface {
 	Name() ProviderName
-	Redirect(w http.ResponseWriter, r *http.Request)
+	Redirect(w http.ResponseWriter, r *http.Request, st *OAuthState)
+}
+
+// ResultProvider is an OAuthProvider that can turn the authorization code
+// from its callback into a ProviderResult.
+type ResultProvider interface {
+	OAuthProvider
+	Result(ctx context.Context, code string, st *OAuthState) (ProviderResult, error)
 }
 
 func NewOAuthProvider(providerName ProviderName) OAuthProvider {
 	switch providerName {
 	case ProviderNameDiscord:
 		return DiscordProvider{}
+	case ProviderNameGitHub:
+		return GitHubProvider{}
 	case ProviderNameGoogle:
 		return GoogleProvider{}
+	case ProviderNameMicrosoft:
+		return MicrosoftProvider{}
+	case ProviderNameReddit:
+		return RedditProvider{}
+	case ProviderNameTwitch:
+		return TwitchProvider{}
+	}
+	if cfg, ok := genericProviderConfigs[providerName]; ok {
+		return NewGenericProvider(cfg)
 	}
 	return nil
 }
 
+// Truncated shortens the profile fields to the sizes of their subscribers columns,
+// since providers don't limit how long names can be
+func (pr ProviderResult) Truncated() ProviderResult {
+	pr.Name = truncateRunes(pr.Name, maxSubscriberNameLength)
+	pr.ProviderSubjectID = truncateRunes(pr.ProviderSubjectID, maxProviderSubjectIDLength)
+	pr.GivenName = truncateRunes(pr.GivenName, maxGivenNameLength)
+	pr.FamilyName = truncateRunes(pr.FamilyName, maxFamilyNameLength)
+	pr.Locale = truncateRunes(pr.Locale, maxLocaleLength)
+	return pr
+}
+
 type DiscordProvider struct{}
 
 func (dp DiscordProvider) Name() ProviderName {
 	return ProviderNameDiscord
 }
 
-func (dp DiscordProvider) Redirect(w http.ResponseWriter, r *http.Request) {
-	var (
-		clientID    = os.Getenv(EnvDiscordClientID)
-		protocol    = os.Getenv(EnvProtocol)
-		hostname    = os.Getenv(EnvHostname)
-		redirectUri = url.QueryEscape(fmt.Sprintf("%s//%s/callback/discord", protocol, hostname))
-	)
-
-	url := fmt.Sprintf(
-		"https://discord.com/oauth2/authorize?client_id=%s&response_type=code&redirect_uri=%s&scope=email+identify",
-		clientID,
-		redirectUri,
-	)
+func (dp DiscordProvider) Redirect(w http.ResponseWriter, r *http.Request, st *OAuthState) {
+	url := DiscordConfig().AuthCodeURL(st.State, st.AuthCodeOptions()...)
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
+func (dp DiscordProvider) Result(ctx context.Context, code string, st *OAuthState) (ProviderResult, error) {
+	discordOauthConfig := DiscordConfig()
+
+	token, err := discordOauthConfig.Exchange(ctx, code, st.ExchangeOptions()...)
+	if err != nil {
+		return ProviderResult{}, newProviderError(ProviderNameDiscord, ProviderErrorStageToken, err)
+	}
+
+	var dpr DiscordProviderResp
+	raw, err := getProfile(discordOauthConfig.Client(ctx, token), "https://discord.com/api/v10/users/@me", nil, &dpr)
+	if err != nil {
+		return ProviderResult{}, newProviderError(ProviderNameDiscord, ProviderErrorStageUserInfo, err)
+	}
+
+	pr := dpr.Result()
+	pr.RawProfile = raw
+	return pr, nil
+}
+
 func (dpr DiscordProviderResp) ToSubscriber(emailListID string) Subscriber {
 	return Subscriber{
 		ID:          NewUUID(),
@@ -61,23 +103,135 @@ func (dpr DiscordProviderResp) ToSubscriber(emailListID string) Subscriber {
 }
 
 func (dpr DiscordProviderResp) Result() ProviderResult {
+	// global_name is the display name, while username is the unique handle
+	name := dpr.Username
+	if dpr.GlobalName != nil && *dpr.GlobalName != "" {
+		name = *dpr.GlobalName
+	}
+
+	avatarURL := ""
+	if dpr.Avatar != "" {
+		avatarURL = fmt.Sprintf("https://cdn.discordapp.com/avatars/%s/%s.png", dpr.ID, dpr.Avatar)
+	}
+
 	return ProviderResult{
-		Name:      dpr.Username,
-		EmailAddr: dpr.Email,
+		Name:              name,
+		EmailAddr:         dpr.Email,
+		EmailVerified:     dpr.Verified,
+		ProviderSubjectID: dpr.ID,
+		AvatarURL:         avatarURL,
+		Locale:            dpr.Locale,
 	}
 }
 
+type GitHubProvider struct{}
+
+func (gp GitHubProvider) Name() ProviderName {
+	return ProviderNameGitHub
+}
+
+func (gp GitHubProvider) Redirect(w http.ResponseWriter, r *http.Request, st *OAuthState) {
+	url := GitHubConfig().AuthCodeURL(st.State, st.AuthCodeOptions()...)
+	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+}
+
+func (gp GitHubProvider) Result(ctx context.Context, code string, st *OAuthState) (ProviderResult, error) {
+	githubOauthConfig := GitHubConfig()
+
+	token, err := githubOauthConfig.Exchange(ctx, code, st.ExchangeOptions()...)
+	if err != nil {
+		return ProviderResult{}, newProviderError(ProviderNameGitHub, ProviderErrorStageToken, err)
+	}
+
+	client := githubOauthConfig.Client(ctx, token)
+
+	var gpr GitHubProviderResp
+	raw, err := getProfile(client, "https://api.github.com/user", nil, &gpr)
+	if err != nil {
+		return ProviderResult{}, newProviderError(ProviderNameGitHub, ProviderErrorStageUserInfo, err)
+	}
+
+	// The /user email is null when the user keeps their address private,
+	// in which case the primary verified address has to be looked up separately
+	if gpr.Email == nil || *gpr.Email == "" {
+		var emails []GitHubEmailResp
+		if err := getJSON(client, "https://api.github.com/user/emails", &emails); err != nil {
+			return ProviderResult{}, newProviderError(ProviderNameGitHub, ProviderErrorStageUserInfo, err)
+		}
+
+		emailAddr, ok := primaryVerifiedGitHubEmail(emails)
+		if !ok {
+			return ProviderResult{}, fmt.Errorf("github user %s has no primary verified email", gpr.Login)
+		}
+		gpr.Email = &emailAddr
+	}
+
+	pr := gpr.Result()
+	pr.RawProfile = raw
+	return pr, nil
+}
+
+func (gpr GitHubProviderResp) Result() ProviderResult {
+	name := gpr.Login
+	if gpr.Name != nil && *gpr.Name != "" {
+		name = *gpr.Name
+	}
+
+	emailAddr := ""
+	if gpr.Email != nil {
+		emailAddr = *gpr.Email
+	}
+
+	// GitHub only lets users make a verified address public, and the private
+	// fallback only ever picks the primary verified address
+	return ProviderResult{
+		Name:              name,
+		EmailAddr:         emailAddr,
+		EmailVerified:     emailAddr != "",
+		ProviderSubjectID: strconv.FormatInt(gpr.ID, 10),
+		AvatarURL:         gpr.AvatarURL,
+	}
+}
+
+func primaryVerifiedGitHubEmail(emails []GitHubEmailResp) (string, bool) {
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			return e.Email, true
+		}
+	}
+	return "", false
+}
+
 type GoogleProvider struct{}
 
 func (gp GoogleProvider) Name() ProviderName {
 	return ProviderNameGoogle
 }
 
-func (gp GoogleProvider) Redirect(w http.ResponseWriter, r *http.Request) {
-	url := GoogleConfig().AuthCodeURL(googleOAuthStateStr())
+func (gp GoogleProvider) Redirect(w http.ResponseWriter, r *http.Request, st *OAuthState) {
+	url := GoogleConfig().AuthCodeURL(st.State, st.AuthCodeOptions()...)
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
+func (gp GoogleProvider) Result(ctx context.Context, code string, st *OAuthState) (ProviderResult, error) {
+	googleOauthConfig := GoogleConfig()
+
+	token, err := googleOauthConfig.Exchange(ctx, code, st.ExchangeOptions()...)
+	if err != nil {
+		return ProviderResult{}, newProviderError(ProviderNameGoogle, ProviderErrorStageToken, err)
+	}
+
+	var gpr GoogleProviderResp
+	raw, err := getProfile(googleOauthConfig.Client(ctx, token), "https://www.googleapis.com/oauth2/v2/userinfo", nil, &gpr)
+	if err != nil {
+		return ProviderResult{}, newProviderError(ProviderNameGoogle, ProviderErrorStageUserInfo, err)
+	}
+
+	pr := gpr.Result()
+	pr.RawProfile = raw
+	return pr, nil
+}
+
 func (gpr GoogleProviderResp) ToSubscriber(emailListID string) Subscriber {
 	return Subscriber{
 		ID:          NewUUID(),
@@ -89,12 +243,455 @@ func (gpr GoogleProviderResp) ToSubscriber(emailListID string) Subscriber {
 
 func (gpr GoogleProviderResp) Result() ProviderResult {
 	return ProviderResult{
-		Name:      gpr.Name,
-		EmailAddr: gpr.Email,
+		Name:              gpr.Name,
+		EmailAddr:         gpr.Email,
+		EmailVerified:     gpr.VerifiedEmail,
+		ProviderSubjectID: gpr.ID,
+		GivenName:         gpr.GivenName,
+		FamilyName:        gpr.FamilyName,
+		AvatarURL:         gpr.Picture,
+		Locale:            gpr.Locale,
+	}
+}
+
+type MicrosoftProvider struct{}
+
+func (mp MicrosoftProvider) Name() ProviderName {
+	return ProviderNameMicrosoft
+}
+
+func (mp MicrosoftProvider) Redirect(w http.ResponseWriter, r *http.Request, st *OAuthState) {
+	url := MicrosoftConfig().AuthCodeURL(st.State, st.AuthCodeOptions()...)
+	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+}
+
+func (mp MicrosoftProvider) Result(ctx context.Context, code string, st *OAuthState) (ProviderResult, error) {
+	microsoftOauthConfig := MicrosoftConfig()
+
+	token, err := microsoftOauthConfig.Exchange(ctx, code, st.ExchangeOptions()...)
+	if err != nil {
+		return ProviderResult{}, newProviderError(ProviderNameMicrosoft, ProviderErrorStageToken, err)
+	}
+
+	var mpr MicrosoftProviderResp
+	raw, err := getProfile(microsoftOauthConfig.Client(ctx, token), "https://graph.microsoft.com/v1.0/me", nil, &mpr)
+	if err != nil {
+		return ProviderResult{}, newProviderError(ProviderNameMicrosoft, ProviderErrorStageUserInfo, err)
+	}
+
+	pr := mpr.Result()
+	if pr.EmailAddr == "" {
+		return ProviderResult{}, fmt.Errorf("microsoft user %s has no email address", mpr.ID)
+	}
+	idToken, _ := token.Extra(OIDCTokenExtraIDToken).(string)
+	pr.EmailVerified = microsoftEmailVerified(idToken)
+	pr.RawProfile = raw
+	return pr, nil
+}
+
+// microsoftEmailVerified reads the claims of the ID token. Microsoft verifies the addresses of
+// personal accounts, but work accounts are only verified when the tenant has proven it owns the
+// address's domain, which is reported by the optional xms_edov claim.
+func microsoftEmailVerified(idToken string) bool {
+	// The ID token came straight from the token endpoint over TLS,
+	// so its signature doesn't need to be checked
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(idToken, claims); err != nil {
+		return false
+	}
+
+	if claims[MicrosoftClaimTenantID] == MicrosoftConsumersTenantID {
+		return true
 	}
+	switch edov := claims[MicrosoftClaimEmailDomainOwnerVerified].(type) {
+	case bool:
+		return edov
+	case string:
+		return edov == StringTrue || edov == "1"
+	}
+	return false
+}
+
+func (mpr MicrosoftProviderResp) Result() ProviderResult {
+	// mail is empty for accounts without an Exchange mailbox, in which case
+	// the user principal name is the address the user signs in with
+	emailAddr := mpr.UserPrincipalName
+	if mpr.Mail != nil && *mpr.Mail != "" {
+		emailAddr = *mpr.Mail
+	}
+
+	// EmailVerified comes from the ID token rather than Graph, see microsoftEmailVerified
+	return ProviderResult{
+		Name:              mpr.DisplayName,
+		EmailAddr:         emailAddr,
+		ProviderSubjectID: mpr.ID,
+		GivenName:         derefString(mpr.GivenName),
+		FamilyName:        derefString(mpr.Surname),
+		Locale:            derefString(mpr.PreferredLanguage),
+	}
+}
+
+type RedditProvider struct{}
+
+func (rp RedditProvider) Name() ProviderName {
+	return ProviderNameReddit
+}
+
+func (rp RedditProvider) Redirect(w http.ResponseWriter, r *http.Request, st *OAuthState) {
+	url := RedditConfig().AuthCodeURL(st.State, st.AuthCodeOptions()...)
+	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+}
+
+func (rp RedditProvider) Result(ctx context.Context, code string, st *OAuthState) (ProviderResult, error) {
+	redditOauthConfig := RedditConfig()
+
+	token, err := redditOauthConfig.Exchange(ctx, code, st.ExchangeOptions()...)
+	if err != nil {
+		return ProviderResult{}, newProviderError(ProviderNameReddit, ProviderErrorStageToken, err)
+	}
+
+	// Reddit rejects API requests that don't identify the app in the User-Agent
+	header := http.Header{}
+	header.Set(HTTPHeaderUserAgent, redditUserAgent)
+
+	var rpr RedditProviderResp
+	_, err = getProfile(redditOauthConfig.Client(ctx, token), "https://oauth.reddit.com/api/v1/me", header, &rpr)
+	if err != nil {
+		return ProviderResult{}, newProviderError(ProviderNameReddit, ProviderErrorStageUserInfo, err)
+	}
+
+	// Reddit's API never exposes a user's email address, so every sign-in is
+	// recorded as a failure rather than silently dropped
+	return ProviderResult{}, newProviderError(ProviderNameReddit, ProviderErrorStageResult, noVerifiedEmailAddr(ProviderNameReddit))
+}
+
+// Result maps the Reddit identity into a ProviderResult. Reddit's API never
+// exposes a user's email address, so EmailAddr is always empty.
+func (rpr RedditProviderResp) Result() ProviderResult {
+	// icon_img comes back HTML escaped, e.g. with &amp; between query params
+	return ProviderResult{
+		Name:              rpr.Name,
+		EmailAddr:         "",
+		ProviderSubjectID: rpr.ID,
+		AvatarURL:         html.UnescapeString(rpr.IconImg),
+	}
+}
+
+type TwitchProvider struct{}
+
+func (tp TwitchProvider) Name() ProviderName {
+	return ProviderNameTwitch
+}
+
+func (tp TwitchProvider) Redirect(w http.ResponseWriter, r *http.Request, st *OAuthState) {
+	url := TwitchConfig().AuthCodeURL(st.State, st.AuthCodeOptions()...)
+	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+}
+
+func (tp TwitchProvider) Result(ctx context.Context, code string, st *OAuthState) (ProviderResult, error) {
+	twitchOauthConfig := TwitchConfig()
+
+	token, err := twitchOauthConfig.Exchange(ctx, code, st.ExchangeOptions()...)
+	if err != nil {
+		return ProviderResult{}, newProviderError(ProviderNameTwitch, ProviderErrorStageToken, err)
+	}
+
+	// The Helix API requires the client ID alongside the bearer token
+	header := http.Header{}
+	header.Set(HTTPHeaderClientID, twitchOauthConfig.ClientID)
+
+	var tpr TwitchProviderResp
+	raw, err := getProfile(twitchOauthConfig.Client(ctx, token), "https://api.twitch.tv/helix/users", header, &tpr)
+	if err != nil {
+		return ProviderResult{}, newProviderError(ProviderNameTwitch, ProviderErrorStageUserInfo, err)
+	}
+	if len(tpr.Data) == 0 {
+		return ProviderResult{}, fmt.Errorf("twitch returned no user")
+	}
+
+	pr := tpr.Result()
+	pr.RawProfile = raw
+	return pr, nil
+}
+
+func (tpr TwitchProviderResp) Result() ProviderResult {
+	if len(tpr.Data) == 0 {
+		return ProviderResult{}
+	}
+	// Twitch only returns an email once the user has verified it
+	return ProviderResult{
+		Name:              tpr.Data[0].DisplayName,
+		EmailAddr:         tpr.Data[0].Email,
+		EmailVerified:     tpr.Data[0].Email != "",
+		ProviderSubjectID: tpr.Data[0].ID,
+		AvatarURL:         tpr.Data[0].ProfileImageURL,
+	}
+}
+
+type GenericProvider struct {
+	cfg GenericProviderConfig
+}
+
+func NewGenericProvider(cfg GenericProviderConfig) GenericProvider {
+	return GenericProvider{cfg: cfg}
+}
+
+func (gp GenericProvider) Name() ProviderName {
+	return gp.cfg.Name
+}
+
+func (gp GenericProvider) Redirect(w http.ResponseWriter, r *http.Request, st *OAuthState) {
+	config, err := gp.Config(r.Context())
+	if err != nil {
+		log.Print(err)
+		RedirectToCatchAllUrl(w, r)
+		return
+	}
+
+	url := config.AuthCodeURL(st.State, st.AuthCodeOptions()...)
+	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+}
+
+// Config builds the oauth2.Config for the provider, resolving any missing
+// endpoints from the issuer's discovery document.
+func (gp GenericProvider) Config(ctx context.Context) (*oauth2.Config, error) {
+	endpoint, _, err := gp.endpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Config{
+		ClientID:     gp.cfg.ClientID,
+		ClientSecret: gp.cfg.ClientSecret,
+		RedirectURL:  gp.cfg.RedirectURL(),
+		Scopes:       gp.cfg.Scopes,
+		Endpoint:     endpoint,
+	}, nil
+}
+
+// Result exchanges the authorization code for a token, then reads the email
+// address and name from the userinfo response using the configured JSON paths.
+func (gp GenericProvider) Result(ctx context.Context, code string, st *OAuthState) (ProviderResult, error) {
+	config, err := gp.Config(ctx)
+	if err != nil {
+		return ProviderResult{}, err
+	}
+
+	_, userInfoURL, err := gp.endpoints(ctx)
+	if err != nil {
+		return ProviderResult{}, err
+	}
+
+	token, err := config.Exchange(ctx, code, st.ExchangeOptions()...)
+	if err != nil {
+		return ProviderResult{}, newProviderError(gp.cfg.Name, ProviderErrorStageToken, err)
+	}
+
+	var userInfo any
+	raw, err := getProfile(config.Client(ctx, token), userInfoURL, nil, &userInfo)
+	if err != nil {
+		return ProviderResult{}, newProviderError(gp.cfg.Name, ProviderErrorStageUserInfo, err)
+	}
+
+	emailAddr, ok := lookupJSONPath(userInfo, gp.cfg.EmailPath)
+	if !ok || emailAddr == "" {
+		return ProviderResult{}, fmt.Errorf("%s userinfo has no email at %q", gp.cfg.Name, gp.cfg.EmailPath)
+	}
+	name, _ := lookupJSONPath(userInfo, gp.cfg.NamePath)
+	emailVerified, _ := lookupJSONPath(userInfo, gp.cfg.EmailVerifiedPath)
+
+	// The rest of the profile is read from the standard OIDC claims
+	var (
+		subjectID, _  = lookupJSONPath(userInfo, OIDCClaimSub)
+		givenName, _  = lookupJSONPath(userInfo, OIDCClaimGivenName)
+		familyName, _ = lookupJSONPath(userInfo, OIDCClaimFamilyName)
+		avatarURL, _  = lookupJSONPath(userInfo, OIDCClaimPicture)
+		locale, _     = lookupJSONPath(userInfo, OIDCClaimLocale)
+	)
+
+	return ProviderResult{
+		Name:              name,
+		EmailAddr:         emailAddr,
+		EmailVerified:     emailVerified == StringTrue,
+		ProviderSubjectID: subjectID,
+		GivenName:         givenName,
+		FamilyName:        familyName,
+		AvatarURL:         avatarURL,
+		Locale:            locale,
+		RawProfile:        raw,
+	}, nil
+}
+
+func (gp GenericProvider) endpoints(ctx context.Context) (oauth2.Endpoint, string, error) {
+	var (
+		endpoint = oauth2.Endpoint{
+			AuthURL:  gp.cfg.AuthURL,
+			TokenURL: gp.cfg.TokenURL,
+		}
+		userInfoURL = gp.cfg.UserInfoURL
+	)
+
+	if endpoint.AuthURL != "" && endpoint.TokenURL != "" && userInfoURL != "" {
+		return endpoint, userInfoURL, nil
+	}
+
+	doc, err := discoverOIDC(ctx, gp.cfg.Issuer)
+	if err != nil {
+		return oauth2.Endpoint{}, "", err
+	}
+
+	endpoint.AuthURL = fallbackIfEmpty(endpoint.AuthURL, doc.AuthorizationEndpoint)
+	endpoint.TokenURL = fallbackIfEmpty(endpoint.TokenURL, doc.TokenEndpoint)
+	userInfoURL = fallbackIfEmpty(userInfoURL, doc.UserinfoEndpoint)
+	if userInfoURL == "" {
+		return oauth2.Endpoint{}, "", fmt.Errorf("generic OAuth provider %s has no userInfoUrl, and %s has no userinfo_endpoint", gp.cfg.Name, gp.cfg.Issuer)
+	}
+
+	return endpoint, userInfoURL, nil
+}
+
+// getJSON makes a GET request with the (usually token-authorized) client and
+// decodes the JSON response body into v.
+func getJSON(client *http.Client, url string, v any) error {
+	return getJSONWithHeader(client, url, nil, v)
+}
+
+func getJSONWithHeader(client *http.Client, url string, header http.Header, v any) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusCodeError{StatusCode: resp.StatusCode}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// getProfile decodes a userinfo response into v, and also returns the raw
+// response so the full profile can be kept alongside the mapped fields.
+func getProfile(client *http.Client, url string, header http.Header, v any) (json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := getJSONWithHeader(client, url, header, &raw); err != nil {
+		return nil, err
+	}
+	return raw, json.Unmarshal(raw, v)
+}
+
+var oidcDiscoveryCache sync.Map
+
+var oidcDiscoveryClient = &http.Client{Timeout: oidcDiscoveryTimeout}
+
+func discoverOIDC(ctx context.Context, issuer string) (*OIDCDiscoveryDoc, error) {
+	if issuer == "" {
+		return nil, fmt.Errorf("issuer is required for OIDC discovery")
+	}
+	if doc, ok := oidcDiscoveryCache.Load(issuer); ok {
+		return doc.(*OIDCDiscoveryDoc), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := oidcDiscoveryClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusCodeError{StatusCode: resp.StatusCode}
+	}
+
+	doc := new(OIDCDiscoveryDoc)
+	if err := json.NewDecoder(resp.Body).Decode(doc); err != nil {
+		return nil, err
+	}
+	// A document for another issuer can't be trusted to point at this one's endpoints
+	if strings.TrimSuffix(doc.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return nil, fmt.Errorf("OIDC discovery document for %s is for issuer %q", issuer, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" {
+		return nil, fmt.Errorf("incomplete OIDC discovery document for %s", issuer)
+	}
+
+	oidcDiscoveryCache.Store(issuer, doc)
+	return doc, nil
+}
+
+// lookupJSONPath walks a decoded JSON value along a dot-separated path,
+// where numeric segments index into arrays (e.g. "data.0.email").
+func lookupJSONPath(v any, path string) (string, bool) {
+	if path == "" {
+		return "", false
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			next, ok := node[key]
+			if !ok {
+				return "", false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", false
+			}
+			v = node[i]
+		default:
+			return "", false
+		}
+	}
+
+	switch value := v.(type) {
+	case string:
+		return value, true
+	case float64, bool:
+		return fmt.Sprint(value), true
+	}
+	return "", false
+}
+
+func genericProviderBySlug(slug string) (GenericProvider, bool) {
+	for _, cfg := range genericProviderConfigs {
+		if providerSlug(cfg.Name) == slug {
+			return NewGenericProvider(cfg), true
+		}
+	}
+	return GenericProvider{}, false
+}
+
+func providerSlug(providerName ProviderName) string {
+	return strings.ToLower(string(providerName))
 }
 
 func ToProviderName(str string) (ProviderName, error) {
+	if pn, err := ToBuiltInProviderName(str); err == nil {
+		return pn, nil
+	}
+	if _, ok := genericProviderConfigs[ProviderName(str)]; ok {
+		return ProviderName(str), nil
+	}
+	return "", fmt.Errorf("invalid ProviderName %s", str)
+}
+
+func ToBuiltInProviderName(str string) (ProviderName, error) {
 	for _, pn := range providerNames {
 		if string(pn) == str {
 			return pn, nil
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testIdPClientID     = "test-client-id"
+	testIdPClientSecret = "test-client-secret"
+	testIdPCode         = "test-code"
+	testIdPAccessToken  = "test-access-token"
+)
+
+// newTestIdP starts an httptest stand-in for an OIDC identity provider.
+// Token requests must carry the PKCE verifier of st.
+func newTestIdP(t *testing.T, st *OAuthState, userInfo any) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(OIDCDiscoveryDoc{
+			Issuer:                server.URL,
+			AuthorizationEndpoint: server.URL + "/authorize",
+			TokenEndpoint:         server.URL + "/token",
+			UserinfoEndpoint:      server.URL + "/userinfo",
+		})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get(FormFieldCode) != testIdPCode {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get(FormFieldCodeVerifier) != st.CodeVerifier {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok {
+			clientID, clientSecret = r.PostForm.Get(FormFieldClientID), r.PostForm.Get(FormFieldClientSecret)
+		}
+		if clientID != testIdPClientID || clientSecret != testIdPClientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set(HTTPHeaderContentType, ContentTypeApplicationJson)
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": testIdPAccessToken,
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	})
+
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HTTPHeaderAuthorization) != BearerHeader(testIdPAccessToken) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set(HTTPHeaderContentType, ContentTypeApplicationJson)
+		json.NewEncoder(w).Encode(userInfo)
+	})
+
+	return server
+}
+
+func TestGenericProvider(t *testing.T) {
+	st, err := NewOAuthState("abcdefgh", "Keycloak", []string{}, "https://bing.com")
+	assert.Nil(t, err)
+
+	t.Run("OIDC discovery", func(t *testing.T) {
+		idp := newTestIdP(t, st, map[string]any{
+			"sub":            "248289761001",
+			"email":          "tomjones@domain.com",
+			"email_verified": true,
+			"name":           "Tom Jones",
+			"given_name":     "Tom",
+			"family_name":    "Jones",
+		})
+
+		cfg := GenericProviderConfig{
+			Name:         "Keycloak",
+			ClientID:     testIdPClientID,
+			ClientSecret: testIdPClientSecret,
+			Issuer:       idp.URL,
+		}.withDefaults()
+		assert.Nil(t, cfg.Validate())
+
+		gp := NewGenericProvider(cfg)
+		assert.Equal(t, ProviderName("Keycloak"), gp.Name())
+
+		config, err := gp.Config(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, idp.URL+"/authorize", config.Endpoint.AuthURL)
+		assert.Equal(t, idp.URL+"/token", config.Endpoint.TokenURL)
+
+		u, err := url.Parse(config.AuthCodeURL(st.State, st.AuthCodeOptions()...))
+		assert.Nil(t, err)
+		assert.Equal(t, st.State, u.Query().Get(QueryParamState))
+		assert.Equal(t, oauth2.S256ChallengeFromVerifier(st.CodeVerifier), u.Query().Get("code_challenge"))
+		assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+		assert.Equal(t, testIdPClientID, u.Query().Get("client_id"))
+		assert.Equal(t, "openid email profile", u.Query().Get("scope"))
+		assert.Equal(t, cfg.RedirectURL(), u.Query().Get("redirect_uri"))
+
+		pr, err := gp.Result(context.Background(), testIdPCode, st)
+		assert.Nil(t, err)
+		assert.Equal(t, "tomjones@domain.com", pr.EmailAddr)
+		assert.Equal(t, "Tom Jones", pr.Name)
+		assert.True(t, pr.EmailVerified)
+		assert.Equal(t, "248289761001", pr.ProviderSubjectID)
+		assert.Equal(t, "Tom", pr.GivenName)
+		assert.Equal(t, "Jones", pr.FamilyName)
+		assert.JSONEq(t, `{
+			"sub": "248289761001",
+			"email": "tomjones@domain.com",
+			"email_verified": true,
+			"name": "Tom Jones",
+			"given_name": "Tom",
+			"family_name": "Jones"
+		}`, string(pr.RawProfile))
+
+		_, err = gp.Result(context.Background(), "wrong-code", st)
+		assert.NotNil(t, err)
+		assert.Equal(t, ProviderErrorStageToken, providerErrorStageOf(err))
+		assert.Equal(t, http.StatusBadRequest, statusCodeOf(err))
+
+		otherSt, err := NewOAuthState("abcdefgh", "Keycloak", []string{}, "https://bing.com")
+		assert.Nil(t, err)
+		_, err = gp.Result(context.Background(), testIdPCode, otherSt)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Explicit endpoints and JSON paths", func(t *testing.T) {
+		idp := newTestIdP(t, st, map[string]any{
+			"data": []any{
+				map[string]any{
+					"profile": map[string]any{"displayName": "Jim Bob"},
+					"emails":  []any{"jimbob@domain.com"},
+				},
+			},
+		})
+
+		cfg := GenericProviderConfig{
+			Name:         "custom_idp",
+			ClientID:     testIdPClientID,
+			ClientSecret: testIdPClientSecret,
+			AuthURL:      idp.URL + "/authorize",
+			TokenURL:     idp.URL + "/token",
+			UserInfoURL:  idp.URL + "/userinfo",
+			EmailPath:    "data.0.emails.0",
+			NamePath:     "data.0.profile.displayName",
+		}.withDefaults()
+		assert.Nil(t, cfg.Validate())
+
+		pr, err := NewGenericProvider(cfg).Result(context.Background(), testIdPCode, st)
+		assert.Nil(t, err)
+		assert.Equal(t, "jimbob@domain.com", pr.EmailAddr)
+		assert.Equal(t, "Jim Bob", pr.Name)
+		assert.False(t, pr.EmailVerified)
+	})
+
+	t.Run("Missing email", func(t *testing.T) {
+		idp := newTestIdP(t, st, map[string]any{"name": "No Email"})
+
+		cfg := GenericProviderConfig{
+			Name:         "NoEmail",
+			ClientID:     testIdPClientID,
+			ClientSecret: testIdPClientSecret,
+			Issuer:       idp.URL,
+		}.withDefaults()
+
+		_, err := NewGenericProvider(cfg).Result(context.Background(), testIdPCode, st)
+		assert.NotNil(t, err)
+		assert.Equal(t, ProviderErrorStageResult, providerErrorStageOf(err))
+	})
+}
+
+func TestGenericProviderConfigValidate(t *testing.T) {
+	valid := GenericProviderConfig{
+		Name:     "GitLab",
+		ClientID: testIdPClientID,
+		Issuer:   "https://gitlab.com",
+	}
+	assert.Nil(t, valid.Validate())
+
+	invalid := []GenericProviderConfig{
+		{Name: "", ClientID: testIdPClientID, Issuer: "https://gitlab.com"},
+		{Name: "has spaces", ClientID: testIdPClientID, Issuer: "https://gitlab.com"},
+		{Name: ProviderNameGoogle, ClientID: testIdPClientID, Issuer: "https://accounts.google.com"},
+		{Name: "discord", ClientID: testIdPClientID, Issuer: "https://discord.com"},
+		{Name: "GitLab", Issuer: "https://gitlab.com"},
+		{Name: "GitLab", ClientID: testIdPClientID, AuthURL: "https://gitlab.com/oauth/authorize"},
+	}
+	for _, cfg := range invalid {
+		assert.NotNil(t, cfg.Validate(), cfg.Name)
+	}
+}
+
+func TestLoadGenericProviderConfigsRejectsDuplicateSlugs(t *testing.T) {
+	t.Setenv(EnvOAuthProviders, `[
+		{"name": "Keycloak", "clientId": "a", "issuer": "https://sso.example.com"},
+		{"name": "keycloak", "clientId": "b", "issuer": "https://sso.example.com"}
+	]`)
+	_, err := LoadGenericProviderConfigs()
+	assert.NotNil(t, err)
+}
+
+func TestDiscoverOIDC(t *testing.T) {
+	var doc OIDCDiscoveryDoc
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(doc)
+	}))
+	defer server.Close()
+
+	// Each case uses its own issuer, since documents are cached by issuer
+	doc = OIDCDiscoveryDoc{Issuer: "https://evil.example.com", AuthorizationEndpoint: "/authorize", TokenEndpoint: "/token"}
+	_, err := discoverOIDC(context.Background(), server.URL+"/mismatched")
+	assert.NotNil(t, err)
+
+	doc = OIDCDiscoveryDoc{Issuer: server.URL + "/no-userinfo/", AuthorizationEndpoint: "/authorize", TokenEndpoint: "/token"}
+	gp := NewGenericProvider(GenericProviderConfig{Name: "NoUserinfo", Issuer: server.URL + "/no-userinfo"})
+	_, _, err = gp.endpoints(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestLookupJSONPath(t *testing.T) {
+	var v any
+	assert.Nil(t, json.Unmarshal([]byte(`{"a":{"b":[{"c":"d"},{"e":true,"f":42}]},"g":null}`), &v))
+
+	s, ok := lookupJSONPath(v, "a.b.0.c")
+	assert.True(t, ok)
+	assert.Equal(t, "d", s)
+
+	s, ok = lookupJSONPath(v, "a.b.1.e")
+	assert.True(t, ok)
+	assert.Equal(t, StringTrue, s)
+
+	s, ok = lookupJSONPath(v, "a.b.1.f")
+	assert.True(t, ok)
+	assert.Equal(t, "42", s)
+
+	for _, path := range []string{"", "x", "a.b.2.c", "a.b.x", "a.b", "g", "a.b.0.c.d"} {
+		_, ok := lookupJSONPath(v, path)
+		assert.False(t, ok, path)
+	}
+}
+
+func TestGitHubProviderResp(t *testing.T) {
+	var (
+		name      = "Tom Jones"
+		emailAddr = "tomjones@domain.com"
+	)
+
+	pr := GitHubProviderResp{Login: "tomjones", Name: &name, Email: &emailAddr}.Result()
+	assert.Equal(t, name, pr.Name)
+	assert.Equal(t, emailAddr, pr.EmailAddr)
+	assert.True(t, pr.EmailVerified)
+
+	pr = GitHubProviderResp{Login: "tomjones"}.Result()
+	assert.Equal(t, "tomjones", pr.Name)
+	assert.Equal(t, "", pr.EmailAddr)
+	assert.False(t, pr.EmailVerified)
+
+	t.Run("Private email fallback", func(t *testing.T) {
+		emails := []GitHubEmailResp{
+			{Email: "unverified@domain.com", Primary: true, Verified: false},
+			{Email: "secondary@domain.com", Primary: false, Verified: true},
+		}
+		_, ok := primaryVerifiedGitHubEmail(emails)
+		assert.False(t, ok)
+
+		emails = append(emails, GitHubEmailResp{Email: emailAddr, Primary: true, Verified: true})
+		e, ok := primaryVerifiedGitHubEmail(emails)
+		assert.True(t, ok)
+		assert.Equal(t, emailAddr, e)
+	})
+}
+
+func TestMicrosoftProviderResp(t *testing.T) {
+	var (
+		mail      = "tomjones@contoso.com"
+		givenName = "Tom"
+		surname   = "Jones"
+	)
+
+	pr := MicrosoftProviderResp{
+		DisplayName:       "Tom Jones",
+		GivenName:         &givenName,
+		Surname:           &surname,
+		Mail:              &mail,
+		UserPrincipalName: "tjones@contoso.onmicrosoft.com",
+	}.Result()
+	assert.Equal(t, "Tom Jones", pr.Name)
+	assert.Equal(t, givenName, pr.GivenName)
+	assert.Equal(t, surname, pr.FamilyName)
+	assert.Equal(t, "", pr.Locale)
+	assert.Equal(t, mail, pr.EmailAddr)
+	assert.False(t, pr.EmailVerified)
+
+	pr = MicrosoftProviderResp{
+		DisplayName:       "Tom Jones",
+		UserPrincipalName: "tjones@contoso.onmicrosoft.com",
+	}.Result()
+	assert.Equal(t, "tjones@contoso.onmicrosoft.com", pr.EmailAddr)
+}
+
+func TestMicrosoftEmailVerified(t *testing.T) {
+	idToken := func(claims jwt.MapClaims) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		assert.Nil(t, err)
+		return s
+	}
+
+	assert.True(t, microsoftEmailVerified(idToken(jwt.MapClaims{"tid": MicrosoftConsumersTenantID})))
+	assert.True(t, microsoftEmailVerified(idToken(jwt.MapClaims{"tid": "contoso", "xms_edov": true})))
+	assert.True(t, microsoftEmailVerified(idToken(jwt.MapClaims{"tid": "contoso", "xms_edov": "1"})))
+	assert.False(t, microsoftEmailVerified(idToken(jwt.MapClaims{"tid": "contoso", "xms_edov": false})))
+	assert.False(t, microsoftEmailVerified(idToken(jwt.MapClaims{"tid": "contoso"})))
+	assert.False(t, microsoftEmailVerified(""))
+	assert.False(t, microsoftEmailVerified("not.a.jwt"))
+}
+
+func TestTwitchProviderResp(t *testing.T) {
+	pr := TwitchProviderResp{
+		Data: []TwitchUser{
+			{Login: "tomjones", DisplayName: "TomJones", Email: "tomjones@domain.com"},
+		},
+	}.Result()
+	assert.Equal(t, "TomJones", pr.Name)
+	assert.Equal(t, "tomjones@domain.com", pr.EmailAddr)
+	assert.True(t, pr.EmailVerified)
+
+	assert.Equal(t, ProviderResult{}, TwitchProviderResp{}.Result())
+}
+
+func TestDiscordProviderResp(t *testing.T) {
+	pr := DiscordProviderResp{Username: "tomjones", Email: "tomjones@domain.com", Verified: true}.Result()
+	assert.Equal(t, "tomjones", pr.Name)
+	assert.Equal(t, "tomjones@domain.com", pr.EmailAddr)
+	assert.True(t, pr.EmailVerified)
+
+	pr = DiscordProviderResp{Username: "tomjones", Email: "tomjones@domain.com"}.Result()
+	assert.False(t, pr.EmailVerified)
+	assert.Equal(t, "", pr.AvatarURL)
+
+	globalName := "Tom Jones"
+	pr = DiscordProviderResp{ID: "80351110224678912", Username: "tomjones", GlobalName: &globalName, Avatar: "8342729096ea3675442027381ff50dfe"}.Result()
+	assert.Equal(t, globalName, pr.Name)
+	assert.Equal(t, "80351110224678912", pr.ProviderSubjectID)
+	assert.Equal(t, "https://cdn.discordapp.com/avatars/80351110224678912/8342729096ea3675442027381ff50dfe.png", pr.AvatarURL)
+}
+
+func TestSubscriberFirstAndLastName(t *testing.T) {
+	firstName, lastName := Subscriber{Name: "Tom Jones", GivenName: "Tom", FamilyName: "Jones"}.FirstAndLastName()
+	assert.Equal(t, "Tom", firstName)
+	assert.Equal(t, "Jones", lastName)
+
+	firstName, lastName = Subscriber{Name: "tomjones"}.FirstAndLastName()
+	assert.Equal(t, "tomjones", firstName)
+	assert.Equal(t, "", lastName)
+}
+
+func TestProviderResultTruncated(t *testing.T) {
+	pr := ProviderResult{
+		Name:       strings.Repeat("n", 150),
+		EmailAddr:  "tomjones@domain.com",
+		GivenName:  strings.Repeat("é", 150),
+		FamilyName: "Jones",
+		Locale:     "en-US",
+	}.Truncated()
+	assert.Equal(t, maxSubscriberNameLength, utf8.RuneCountInString(pr.Name))
+	assert.Equal(t, strings.Repeat("é", maxGivenNameLength), pr.GivenName)
+	assert.Equal(t, "Jones", pr.FamilyName)
+	assert.Equal(t, "en-US", pr.Locale)
+	assert.Equal(t, "tomjones@domain.com", pr.EmailAddr)
+}
@@ -1,15 +1,15 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
+	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/awslabs/aws-lambda-go-api-proxy/core"
@@ -42,9 +42,10 @@ func NewServer(listenAddr string) *Server {
 }
 
 type JsonResponse struct {
-	Success bool   `json:"success"`
-	Data    any    `json:"data,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Success    bool   `json:"success"`
+	Data       any    `json:"data,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	Error      string `json:"error,omitempty"`
 }
 
 func NewJsonResponse(success bool, data any, err error) *JsonResponse {
@@ -59,6 +60,15 @@ func NewJsonResponse(success bool, data any, err error) *JsonResponse {
 	}
 }
 
+// NewJsonPageResponse is a successful response for one page of a list endpoint
+func NewJsonPageResponse(data any, nextCursor string) *JsonResponse {
+	return &JsonResponse{
+		Success:    true,
+		Data:       data,
+		NextCursor: nextCursor,
+	}
+}
+
 func addRoutes(router *mux.Router) {
 	// Auth
 	router.HandleFunc("/login", handleGetLogin).Methods(http.MethodGet)
@@ -74,10 +84,31 @@ func addRoutes(router *mux.Router) {
 	router.HandleFunc("/t/discord/{emailListID}", handleDiscordCampaign).Methods(http.MethodGet)
 	router.HandleFunc("/callback/discord", handleDiscordCampaignCallback).Methods(http.MethodGet)
 
+	// GitHub campaigns
+	router.HandleFunc("/t/github/{emailListID}", handleGitHubCampaign).Methods(http.MethodGet)
+	router.HandleFunc("/callback/github", handleGitHubCampaignCallback).Methods(http.MethodGet)
+
 	// Google campaigns
 	router.HandleFunc("/t/google/{emailListID}", handleGoogleCampaign).Methods(http.MethodGet)
 	router.HandleFunc("/callback/google", handleGoogleCampaignCallback).Methods(http.MethodGet)
 
+	// Microsoft campaigns
+	router.HandleFunc("/t/microsoft/{emailListID}", handleMicrosoftCampaign).Methods(http.MethodGet)
+	router.HandleFunc("/callback/microsoft", handleMicrosoftCampaignCallback).Methods(http.MethodGet)
+
+	// Reddit campaigns
+	router.HandleFunc("/t/reddit/{emailListID}", handleRedditCampaign).Methods(http.MethodGet)
+	router.HandleFunc("/callback/reddit", handleRedditCampaignCallback).Methods(http.MethodGet)
+
+	// Twitch campaigns
+	router.HandleFunc("/t/twitch/{emailListID}", handleTwitchCampaign).Methods(http.MethodGet)
+	router.HandleFunc("/callback/twitch", handleTwitchCampaignCallback).Methods(http.MethodGet)
+
+	// Generic (config-driven) provider campaigns, registered after the
+	// built-in providers so that their routes take precedence
+	router.HandleFunc("/t/{providerSlug}/{emailListID}", handleGenericCampaign).Methods(http.MethodGet)
+	router.HandleFunc("/callback/{providerSlug}", handleGenericCampaignCallback).Methods(http.MethodGet)
+
 	// Users
 	router.HandleFunc("/users", RootAuth(handleInsertNewUser)).Methods(http.MethodPost)
 	router.HandleFunc("/users", RootAuth(handleGetAllUsers)).Methods(http.MethodGet)
@@ -88,16 +119,41 @@ func addRoutes(router *mux.Router) {
 	// Email lists
 	router.HandleFunc("/email-lists", handleInsertNewEmailListByUserID).Methods(http.MethodPost)
 	router.HandleFunc("/email-lists", handleGetAllEmailListsByUserID).Methods(http.MethodGet)
+	router.HandleFunc("/email-lists/{emailListID}", handleGetEmailListByIDAndUserID).Methods(http.MethodGet)
+	router.HandleFunc("/email-lists/{emailListID}", handleUpdateEmailListByIDAndUserID).Methods(http.MethodPatch)
+	router.HandleFunc("/email-lists/{emailListID}", handleDeleteEmailListByIDAndUserID).Methods(http.MethodDelete)
+	router.HandleFunc("/email-lists/{emailListID}/export", handleExportEmailListByIDAndUserID).Methods(http.MethodGet)
+	router.HandleFunc("/email-lists/{emailListID}/import", handleImportEmailListByIDAndUserID).Methods(http.MethodPost)
+	router.HandleFunc("/email-lists/{emailListID}/outputs", handleGetAllOutputsByEmailListIDAndUserID).Methods(http.MethodGet)
+	router.HandleFunc("/email-lists/{emailListID}/outputs/{outputID}", handleInsertEmailListOutputByUserID).Methods(http.MethodPut)
+	router.HandleFunc("/email-lists/{emailListID}/outputs/{outputID}", handleDeleteEmailListOutputByUserID).Methods(http.MethodDelete)
 
 	// Subscribers
 	router.HandleFunc("/subscribers", handleInsertNewSubscriberByEmailListIDAndUserID).Methods(http.MethodPost)
 	router.HandleFunc("/subscribers", handleGetAllSubscribersByUserID).Methods(http.MethodGet)
+	router.HandleFunc("/subscribers/{subscriberID}", handleGetSubscriberByIDAndUserID).Methods(http.MethodGet)
+	router.HandleFunc("/subscribers/{subscriberID}", handleUpdateSubscriberByIDAndUserID).Methods(http.MethodPatch)
+	router.HandleFunc("/subscribers/{subscriberID}", handleDeleteSubscriberByIDAndUserID).Methods(http.MethodDelete)
+	router.HandleFunc("/subscribers/{subscriberID}/deliveries", handleGetAllDeliveriesBySubscriberIDAndUserID).Methods(http.MethodGet)
+	router.HandleFunc("/subscribers/{subscriberID}/joins", handleGetAllSubscriberJoinsBySubscriberIDAndUserID).Methods(http.MethodGet)
 
 	// Outputs
 	router.HandleFunc("/outputs", handleInsertNewOutputByUserID).Methods(http.MethodPost)
 	router.HandleFunc("/outputs", handleGetAllOutputsByUserID).Methods(http.MethodGet)
+	router.HandleFunc("/outputs/schemas", handleGetOutputSchemas).Methods(http.MethodGet)
 	router.HandleFunc("/outputs/{outputID}", handleGetOutputByIDAndUserID).Methods(http.MethodGet)
 	router.HandleFunc("/outputs/{outputID}", handleUpdateOutputByIDAndUserID).Methods(http.MethodPatch)
+	router.HandleFunc("/outputs/{outputID}", handleDeleteOutputByIDAndUserID).Methods(http.MethodDelete)
+	router.HandleFunc("/outputs/{outputID}/deliveries", handleGetAllDeliveriesByOutputIDAndUserID).Methods(http.MethodGet)
+	router.HandleFunc("/outputs/{outputID}/replay", handleReplayOutputByIDAndUserID).Methods(http.MethodPost)
+
+	// Outbox
+	router.HandleFunc("/outbox", handleGetAllOutboxJobsByUserID).Methods(http.MethodGet)
+	router.HandleFunc("/outbox/dispatch", RootAuth(handleDispatchOutbox)).Methods(http.MethodPost)
+	router.HandleFunc("/outbox/{jobID}/retry", handleRetryOutboxJobByIDAndUserID).Methods(http.MethodPost)
+
+	// Provider failures
+	router.HandleFunc("/provider-failures", handleGetAllProviderFailuresByEmailListIDAndUserID).Methods(http.MethodGet)
 
 	// Misc
 	router.HandleFunc("/healthz", handleHealthz)
@@ -178,14 +234,33 @@ func handleCampaign(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pc := NewProviderCookie(emailListID, provider.Name(), outputIDs, redirectUrl)
-	if err := pc.Set(w); err != nil {
+	redirectToProvider(w, r, provider, emailListID, outputIDs, redirectUrl)
+}
+
+// redirectToProvider saves the campaign context under a fresh state parameter,
+// then sends the visitor on to the OAuth provider
+func redirectToProvider(
+	w http.ResponseWriter,
+	r *http.Request,
+	provider OAuthProvider,
+	emailListID string,
+	outputIDs []string,
+	redirectUrl string,
+) {
+	st, err := NewOAuthState(emailListID, provider.Name(), outputIDs, redirectUrl)
+	if err != nil {
+		log.Print(err)
+		RedirectToCatchAllUrl(w, r)
+		return
+	}
+
+	if err := storage.InsertNewOAuthState(st); err != nil {
 		log.Print(err)
 		RedirectToCatchAllUrl(w, r)
 		return
 	}
 
-	provider.Redirect(w, r)
+	provider.Redirect(w, r, st)
 }
 
 func makeProviderCampaignHandlerFunc(providerName ProviderName) http.HandlerFunc {
@@ -195,7 +270,7 @@ func makeProviderCampaignHandlerFunc(providerName ProviderName) http.HandlerFunc
 			redirectUrl = r.URL.Query().Get("r")
 		)
 
-		emailListID := mux.Vars(r)["emailListID"]
+		emailListID := mux.Vars(r)[MuxVarEmailListID]
 		if emailListID == "" {
 			RedirectToCatchAllUrl(w, r)
 			return
@@ -203,14 +278,7 @@ func makeProviderCampaignHandlerFunc(providerName ProviderName) http.HandlerFunc
 
 		provider := NewOAuthProvider(providerName)
 
-		pc := NewProviderCookie(emailListID, provider.Name(), outputIDs, redirectUrl)
-		if err := pc.Set(w); err != nil {
-			log.Print(err)
-			RedirectToCatchAllUrl(w, r)
-			return
-		}
-
-		provider.Redirect(w, r)
+		redirectToProvider(w, r, provider, emailListID, outputIDs, redirectUrl)
 	}
 }
 
@@ -219,144 +287,103 @@ func handleDiscordCampaign(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleDiscordCampaignCallback(w http.ResponseWriter, r *http.Request) {
-	pc, err := ProviderCookieFrom(r)
-	if err != nil {
-		log.Print(err)
-		RedirectToCatchAllUrl(w, r)
-		return
-	}
-
-	RedirectVisitor(w, r, pc.RedirectUrl)
+	handleProviderCallback(w, r, DiscordProvider{})
+}
 
-	code := r.URL.Query().Get(QueryParamCode)
-	if code == "" {
-		return
-	}
+func handleGitHubCampaign(w http.ResponseWriter, r *http.Request) {
+	makeProviderCampaignHandlerFunc(ProviderNameGitHub)(w, r)
+}
 
-	var (
-		protocol    = os.Getenv(EnvProtocol)
-		hostname    = os.Getenv(EnvHostname)
-		redirectUri = fmt.Sprintf("%s//%s/callback/discord", protocol, hostname)
-	)
+func handleGitHubCampaignCallback(w http.ResponseWriter, r *http.Request) {
+	handleProviderCallback(w, r, GitHubProvider{})
+}
 
-	formData := url.Values{}
-	formData.Set(FormFieldClientID, os.Getenv(EnvDiscordClientID))
-	formData.Set(FormFieldClientSecret, os.Getenv(EnvDiscordClientSecret))
-	formData.Set(FormFieldGrantType, FormValueAuthorizationCode)
-	formData.Set(FormFieldCode, code)
-	formData.Set(FormFieldRedirectUri, redirectUri)
+func handleGoogleCampaign(w http.ResponseWriter, r *http.Request) {
+	makeProviderCampaignHandlerFunc(ProviderNameGoogle)(w, r)
+}
 
-	encodedFormData := formData.Encode()
+func handleGoogleCampaignCallback(w http.ResponseWriter, r *http.Request) {
+	handleProviderCallback(w, r, GoogleProvider{})
+}
 
-	req, err := http.NewRequest(
-		http.MethodPost,
-		"https://discord.com/api/oauth2/token",
-		bytes.NewBufferString(encodedFormData),
-	)
-	if err != nil {
-		log.Print(err)
-		return
-	}
-	req.Header.Add(HTTPHeaderAcceptEncoding, ContentTypeApplicationXwwwFormUrlEncoded)
-	req.Header.Add(HTTPHeaderContentType, ContentTypeApplicationXwwwFormUrlEncoded)
+func handleMicrosoftCampaign(w http.ResponseWriter, r *http.Request) {
+	makeProviderCampaignHandlerFunc(ProviderNameMicrosoft)(w, r)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Print(err)
-		return
-	}
-	defer resp.Body.Close()
+func handleMicrosoftCampaignCallback(w http.ResponseWriter, r *http.Request) {
+	handleProviderCallback(w, r, MicrosoftProvider{})
+}
 
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return
-	}
+func handleRedditCampaign(w http.ResponseWriter, r *http.Request) {
+	makeProviderCampaignHandlerFunc(ProviderNameReddit)(w, r)
+}
 
-	var tokenResp DiscordOAuth2TokenResp
-	if err := json.NewDecoder(bytes.NewReader(b)).Decode(&tokenResp); err != nil {
-		log.Print(err)
-		return
-	}
+func handleRedditCampaignCallback(w http.ResponseWriter, r *http.Request) {
+	handleProviderCallback(w, r, RedditProvider{})
+}
 
-	req2, err := http.NewRequest(http.MethodGet, "https://discord.com/api/v10/users/@me", nil)
-	if err != nil {
-		log.Print(err)
-		return
-	}
-	req2.Header.Add(HTTPHeaderAuthorization, BearerHeader(tokenResp.AccessToken))
+func handleTwitchCampaign(w http.ResponseWriter, r *http.Request) {
+	makeProviderCampaignHandlerFunc(ProviderNameTwitch)(w, r)
+}
 
-	resp2, err := client.Do(req2)
-	if err != nil {
-		log.Print(err)
-		return
-	}
-	defer resp.Body.Close()
+func handleTwitchCampaignCallback(w http.ResponseWriter, r *http.Request) {
+	handleProviderCallback(w, r, TwitchProvider{})
+}
 
-	bodyBytes, err := io.ReadAll(resp2.Body)
-	if err != nil {
-		log.Print(err)
+func handleGenericCampaign(w http.ResponseWriter, r *http.Request) {
+	provider, ok := genericProviderBySlug(mux.Vars(r)[MuxVarProviderSlug])
+	if !ok {
+		RedirectToCatchAllUrl(w, r)
 		return
 	}
+	makeProviderCampaignHandlerFunc(provider.Name())(w, r)
+}
 
-	var dpr DiscordProviderResp
-	if err := json.NewDecoder(bytes.NewReader(bodyBytes)).Decode(&dpr); err != nil {
-		log.Print(err)
+func handleGenericCampaignCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := genericProviderBySlug(mux.Vars(r)[MuxVarProviderSlug])
+	if !ok {
+		RedirectToCatchAllUrl(w, r)
 		return
 	}
-
-	pc.Handle(dpr.Result())
+	handleProviderCallback(w, r, provider)
 }
 
-func handleGoogleCampaign(w http.ResponseWriter, r *http.Request) {
-	makeProviderCampaignHandlerFunc(ProviderNameGoogle)(w, r)
-}
-
-func handleGoogleCampaignCallback(w http.ResponseWriter, r *http.Request) {
-	pc, err := ProviderCookieFrom(r)
+func handleProviderCallback(w http.ResponseWriter, r *http.Request, provider ResultProvider) {
+	st, err := ConsumeOAuthState(r, provider.Name())
 	if err != nil {
 		log.Print(err)
 		RedirectToCatchAllUrl(w, r)
 		return
 	}
 
-	RedirectVisitor(w, r, pc.RedirectUrl)
-
-	state := r.URL.Query().Get(QueryParamState)
-	if state != googleOAuthStateStr() {
-		return
-	}
-
-	googleOauthConfig := GoogleConfig()
+	RedirectVisitor(w, r, st.RedirectUrl)
 
-	code := r.URL.Query().Get(QueryParamCode)
-	token, err := googleOauthConfig.Exchange(context.Background(), code)
-	if err != nil {
+	// The provider sends the visitor back with an error instead of a code
+	// when they deny access or the authorization request was rejected
+	if errCode := r.URL.Query().Get(QueryParamError); errCode != "" {
+		err := newProviderError(provider.Name(), ProviderErrorStageAuthorize, fmt.Errorf("%s: %s", errCode, r.URL.Query().Get(QueryParamErrorDescription)))
 		log.Print(err)
+		st.RecordFailure(err)
 		return
 	}
 
-	client := googleOauthConfig.Client(context.Background(), token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
-	if err != nil {
-		log.Print(err)
+	code := r.URL.Query().Get(QueryParamCode)
+	if code == "" {
 		return
 	}
-	defer resp.Body.Close()
 
-	b, err := io.ReadAll(resp.Body)
+	pr, err := provider.Result(context.Background(), code, st)
 	if err != nil {
 		log.Print(err)
+		st.RecordFailure(err)
 		return
 	}
 
-	var gpr GoogleProviderResp
-	if err := json.NewDecoder(bytes.NewReader(b)).Decode(&gpr); err != nil {
+	if err := st.Handle(pr); err != nil {
+		err = newProviderError(provider.Name(), ProviderErrorStageHandle, err)
 		log.Print(err)
-		return
+		st.RecordFailure(err)
 	}
-
-	pc.Handle(gpr.Result())
 }
 
 func handleMakeCampaign(w http.ResponseWriter, r *http.Request) {
@@ -419,14 +446,20 @@ func handleInsertNewUser(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, NewJsonResponse(true, user, nil))
 }
 
-func handleGetAllUsers(w http.ResponseWriter, _ *http.Request) {
-	users, err := storage.GetAllUsers()
+func handleGetAllUsers(w http.ResponseWriter, r *http.Request) {
+	page, err := ParsePage(r, userSortColumns, SortKeyCreatedAt)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	users, nextCursor, err := storage.GetAllUsers(page)
 	if err != nil {
 		log.Print(err)
 		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
 		return
 	}
-	WriteJSON(w, http.StatusOK, NewJsonResponse(true, users, nil))
+	WriteJSON(w, http.StatusOK, NewJsonPageResponse(users, nextCursor))
 }
 
 func handleGetUserByID(w http.ResponseWriter, r *http.Request) {
@@ -518,6 +551,7 @@ func handleInsertNewEmailListByUserID(w http.ResponseWriter, r *http.Request) {
 func handleGetAllEmailListsByUserID(w http.ResponseWriter, r *http.Request) {
 	var (
 		emailLists []*EmailList
+		nextCursor string
 		err        error
 	)
 
@@ -528,10 +562,16 @@ func handleGetAllEmailListsByUserID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	page, err := ParsePage(r, emailListSortColumns, SortKeyCreatedAt)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+		return
+	}
+
 	if IsRootUser(user) {
-		emailLists, err = storage.GetAllEmailLists()
+		emailLists, nextCursor, err = storage.GetAllEmailLists(page)
 	} else {
-		emailLists, err = storage.GetAllEmailListsByUserID(user.ID)
+		emailLists, nextCursor, err = storage.GetAllEmailListsByUserID(user.ID, page)
 	}
 	if err != nil {
 		log.Print(err)
@@ -539,43 +579,42 @@ func handleGetAllEmailListsByUserID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, NewJsonResponse(true, emailLists, nil))
+	WriteJSON(w, http.StatusOK, NewJsonPageResponse(emailLists, nextCursor))
 }
 
-func handleInsertNewSubscriberByEmailListIDAndUserID(w http.ResponseWriter, r *http.Request) {
-	user, err := useProtectedRoute(w, r)
-	if err != nil {
-		log.Print(err)
-		WriteUnauthorized(w)
-		return
-	}
+// useEmailList looks up the email list in the emailListID route variable, making sure
+// it belongs to the user unless they are the root user. It writes the error response
+// itself, and returns nil if the request should go no further.
+func useEmailList(w http.ResponseWriter, r *http.Request, user *User) *EmailList {
+	return useEmailListByID(w, mux.Vars(r)[MuxVarEmailListID], user)
+}
 
-	var cr SubscriberCreationReq
-	if err := json.NewDecoder(r.Body).Decode(&cr); err != nil {
-		log.Print(err)
-		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
-		return
-	}
-	if !IsRootUser(user) {
-		cr.UserID = user.ID
+// useEmailListByID is useEmailList for routes that take the email list ID from the request body.
+func useEmailListByID(w http.ResponseWriter, emailListID string, user *User) *EmailList {
+	if emailListID == "" {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, emailListIDNotProvided()))
+		return nil
 	}
 
-	subscriber, err := storage.InsertNewSubscriber(cr)
+	var (
+		emailList *EmailList
+		err       error
+	)
+	if IsRootUser(user) {
+		emailList, err = storage.GetEmailListByID(emailListID)
+	} else {
+		emailList, err = storage.GetEmailListByIDAndUserID(emailListID, user.ID)
+	}
 	if err != nil {
 		log.Print(err)
-		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
-		return
+		WriteJSON(w, http.StatusNotFound, NewJsonResponse(false, nil, err))
+		return nil
 	}
 
-	WriteJSON(w, http.StatusOK, NewJsonResponse(true, subscriber, nil))
+	return emailList
 }
 
-func handleGetAllSubscribersByUserID(w http.ResponseWriter, r *http.Request) {
-	var (
-		subscribers []*Subscriber
-		err         error
-	)
-
+func handleGetEmailListByIDAndUserID(w http.ResponseWriter, r *http.Request) {
 	user, err := useProtectedRoute(w, r)
 	if err != nil {
 		log.Print(err)
@@ -583,21 +622,15 @@ func handleGetAllSubscribersByUserID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if IsRootUser(user) {
-		subscribers, err = storage.GetAllSubscribers()
-	} else {
-		subscribers, err = storage.GetAllSubscribersByUserID(user.ID)
-	}
-	if err != nil {
-		log.Print(err)
-		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+	emailList := useEmailList(w, r, user)
+	if emailList == nil {
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, NewJsonResponse(true, subscribers, nil))
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, emailList, nil))
 }
 
-func handleInsertNewOutputByUserID(w http.ResponseWriter, r *http.Request) {
+func handleUpdateEmailListByIDAndUserID(w http.ResponseWriter, r *http.Request) {
 	user, err := useProtectedRoute(w, r)
 	if err != nil {
 		log.Print(err)
@@ -605,32 +638,28 @@ func handleInsertNewOutputByUserID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var cr OutputCreationReq
-	if err := json.NewDecoder(r.Body).Decode(&cr); err != nil {
+	emailList := useEmailList(w, r, user)
+	if emailList == nil {
+		return
+	}
+
+	var ur EmailListUpdateReq
+	if err := json.NewDecoder(r.Body).Decode(&ur); err != nil {
 		log.Print(err)
 		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
 		return
 	}
-	if !IsRootUser(user) {
-		cr.UserID = user.ID
-	}
 
-	output, err := storage.InsertNewOutput(cr)
-	if err != nil {
+	if err := storage.UpdateEmailListByID(emailList.ID, ur); err != nil {
 		log.Print(err)
 		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, NewJsonResponse(true, output, nil))
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, nil, nil))
 }
 
-func handleGetAllOutputsByUserID(w http.ResponseWriter, r *http.Request) {
-	var (
-		outputs []Output
-		err     error
-	)
-
+func handleDeleteEmailListByIDAndUserID(w http.ResponseWriter, r *http.Request) {
 	user, err := useProtectedRoute(w, r)
 	if err != nil {
 		log.Print(err)
@@ -638,25 +667,30 @@ func handleGetAllOutputsByUserID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if IsRootUser(user) {
-		outputs, err = storage.GetAllOutputs()
-	} else {
-		outputs, err = storage.GetAllOutputsByUserID(user.ID)
+	emailList := useEmailList(w, r, user)
+	if emailList == nil {
+		return
 	}
-	if err != nil {
+
+	mode := EmailListDeleteMode(r.URL.Query().Get(QueryParamSubscribers))
+	if mode == "" {
+		mode = EmailListDeleteModeArchive
+	}
+	if mode != EmailListDeleteModeArchive && mode != EmailListDeleteModeCascade {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, invalidEmailListDeleteMode(mode)))
+		return
+	}
+
+	if err := storage.DeleteEmailListByID(emailList.ID, mode); err != nil {
 		log.Print(err)
-		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, outputIDNotProvided()))
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
 		return
 	}
-	WriteJSON(w, http.StatusOK, NewJsonResponse(true, makeOutputsData(outputs), nil))
-}
 
-func handleGetOutputByIDAndUserID(w http.ResponseWriter, r *http.Request) {
-	var (
-		output Output
-		err    error
-	)
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, nil, nil))
+}
 
+func handleExportEmailListByIDAndUserID(w http.ResponseWriter, r *http.Request) {
 	user, err := useProtectedRoute(w, r)
 	if err != nil {
 		log.Print(err)
@@ -664,27 +698,87 @@ func handleGetOutputByIDAndUserID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	outputID := mux.Vars(r)[MuxVarOutputID]
-	if outputID == "" {
-		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, outputIDNotProvided()))
+	emailList := useEmailList(w, r, user)
+	if emailList == nil {
 		return
 	}
 
-	if IsRootUser(user) {
-		output, err = storage.GetOutputByID(outputID)
-	} else {
-		output, err = storage.GetOutputByIDAndUserID(outputID, user.ID)
+	format := FileFormat(fallbackIfEmpty(r.URL.Query().Get(QueryParamFormat), string(FileFormatCSV)))
+	if !validFileFormat(format) {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, invalidFileFormat(format)))
+		return
+	}
+
+	page, err := ParsePage(r, subscriberSortColumns, SortKeyCreatedAt)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+		return
+	}
+	if r.URL.Query().Get(QueryParamLimit) == "" {
+		page.Limit = exportChunkSize
 	}
+
+	// The Lambda adapter buffers the whole response and caps its size, so there
+	// only one chunk is sent per request, along with the cursor for the next one.
+	// Otherwise the chunks are streamed one after another in a single response.
+	chunked := runningFromServerless()
+
+	filter := SubscriberFilter{EmailListID: emailList.ID}
+	subscribers, nextCursor, err := storage.GetAllSubscribersByFilter(filter, page)
 	if err != nil {
 		log.Print(err)
-		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, outputIDNotProvided()))
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, output)
+	w.Header().Set(HTTPHeaderContentType, fileFormatContentType(format))
+	w.Header().Set(HTTPHeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.%s"`, emailList.ID, format))
+	if chunked && nextCursor != "" {
+		w.Header().Set(HTTPHeaderNextCursor, nextCursor)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	ew := newExportWriter(w, format)
+	// Only the first chunk has a header row, so that chunks can be appended to each other
+	if page.Cursor == nil {
+		if err := ew.WriteHeader(); err != nil {
+			log.Print(err)
+			return
+		}
+	}
+
+	for {
+		for _, subscriber := range subscribers {
+			if err := ew.Write(subscriber); err != nil {
+				log.Print(err)
+				return
+			}
+		}
+		if err := ew.Flush(); err != nil {
+			log.Print(err)
+			return
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		if chunked || nextCursor == "" {
+			return
+		}
+
+		// The status has already been sent, so from here errors can only cut the export short
+		if page.Cursor, err = decodePageCursor(nextCursor); err != nil {
+			log.Print(err)
+			return
+		}
+		if subscribers, nextCursor, err = storage.GetAllSubscribersByFilter(filter, page); err != nil {
+			log.Print(err)
+			return
+		}
+	}
 }
 
-func handleUpdateOutputByIDAndUserID(w http.ResponseWriter, r *http.Request) {
+func handleImportEmailListByIDAndUserID(w http.ResponseWriter, r *http.Request) {
 	user, err := useProtectedRoute(w, r)
 	if err != nil {
 		log.Print(err)
@@ -692,37 +786,919 @@ func handleUpdateOutputByIDAndUserID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	outputID := mux.Vars(r)[MuxVarOutputID]
-	if outputID == "" {
-		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, outputIDNotProvided()))
+	emailList := useEmailList(w, r, user)
+	if emailList == nil {
 		return
 	}
 
-	var ur OutputUpdateReq
-	if err := json.NewDecoder(r.Body).Decode(&ur); err != nil {
-		log.Print(err)
-		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+	format := FileFormat(fallbackIfEmpty(r.URL.Query().Get(QueryParamFormat), string(FileFormatCSV)))
+	if !validFileFormat(format) {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, invalidFileFormat(format)))
 		return
 	}
 
-	userID := user.ID
-	if IsRootUser(user) {
-		output, err := storage.GetOutputByID(outputID)
+	// New subscribers are only sent to outputs that belong to the owner of the list
+	outputIDs := r.URL.Query()[QueryParamOutputID]
+	for _, outputID := range outputIDs {
+		if _, err := storage.GetOutputByIDAndUserID(outputID, emailList.UserID); err != nil {
+			log.Print(err)
+			WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+			return
+		}
+	}
+	if len(outputIDs) == 0 && r.URL.Query().Get(QueryParamFanOut) == StringTrue {
+		outputs, err := storage.GetAllOutputsByEmailListID(emailList.ID)
 		if err != nil {
 			log.Print(err)
 			WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
 			return
 		}
-		userID = output.GetUserID()
+		for _, output := range outputs {
+			outputIDs = append(outputIDs, output.GetID())
+		}
 	}
 
-	if err := storage.UpdateOutputByIDAndUserID(outputID, userID, ur); err != nil {
+	var (
+		result      = ImportResult{Invalid: []ImportInvalidRow{}}
+		subscribers = []*Subscriber{}
+		seen        = make(map[string]bool)
+	)
+	err = readImportRows(http.MaxBytesReader(w, r.Body, maxImportBytes), format, func(line int, row importRow, err error) {
+		var subscriber *Subscriber
+		if err == nil {
+			subscriber, err = newImportSubscriber(emailList, row)
+		}
+		if err != nil {
+			result.Invalid = append(result.Invalid, ImportInvalidRow{Line: line, Error: err.Error()})
+			return
+		}
+
+		if seen[subscriber.EmailAddr] {
+			result.Skipped++
+			return
+		}
+		seen[subscriber.EmailAddr] = true
+		subscribers = append(subscribers, subscriber)
+	})
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	inserted, err := storage.ImportSubscribers(subscribers)
+	if err != nil {
 		log.Print(err)
 		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
 		return
 	}
+	result.Inserted = len(inserted)
+	result.Skipped += len(subscribers) - len(inserted)
 
-	WriteJSON(w, http.StatusOK, NewJsonResponse(true, nil, nil))
+	// The deliveries are left to the outbox dispatcher rather than made here,
+	// as a large import would otherwise hold the request open for a long time
+	jobs := []*OutboxJob{}
+	for _, subscriber := range inserted {
+		for _, outputID := range outputIDs {
+			jobs = append(jobs, NewOutboxJob(outputID, emailList.UserID, *subscriber))
+		}
+	}
+	if len(jobs) > 0 {
+		if err := storage.InsertNewOutboxJobs(jobs); err != nil {
+			log.Print(err)
+			WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, result, err))
+			return
+		}
+	}
+	result.Queued = len(jobs)
+
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, result, nil))
+}
+
+func handleGetAllOutputsByEmailListIDAndUserID(w http.ResponseWriter, r *http.Request) {
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	emailList := useEmailList(w, r, user)
+	if emailList == nil {
+		return
+	}
+
+	outputs, err := storage.GetAllOutputsByEmailListID(emailList.ID)
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, makeOutputsData(outputs), nil))
+}
+
+func handleInsertEmailListOutputByUserID(w http.ResponseWriter, r *http.Request) {
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	emailList := useEmailList(w, r, user)
+	if emailList == nil {
+		return
+	}
+
+	outputID := mux.Vars(r)[MuxVarOutputID]
+	if outputID == "" {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, outputIDNotProvided()))
+		return
+	}
+
+	// Only outputs that belong to the same user as the list can be attached to it
+	output, err := storage.GetOutputByIDAndUserID(outputID, emailList.UserID)
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusNotFound, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	if err := storage.InsertEmailListOutput(emailList.ID, output.GetID()); err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, nil, nil))
+}
+
+func handleDeleteEmailListOutputByUserID(w http.ResponseWriter, r *http.Request) {
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	emailList := useEmailList(w, r, user)
+	if emailList == nil {
+		return
+	}
+
+	outputID := mux.Vars(r)[MuxVarOutputID]
+	if outputID == "" {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, outputIDNotProvided()))
+		return
+	}
+
+	if err := storage.DeleteEmailListOutput(emailList.ID, outputID); err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, nil, nil))
+}
+
+func handleInsertNewSubscriberByEmailListIDAndUserID(w http.ResponseWriter, r *http.Request) {
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	var cr SubscriberCreationReq
+	if err := json.NewDecoder(r.Body).Decode(&cr); err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	emailList := useEmailListByID(w, cr.EmailListID, user)
+	if emailList == nil {
+		return
+	}
+	// Subscribers belong to the owner of their email list
+	cr.UserID = emailList.UserID
+
+	emailAddr, err := normalizeEmailAddr(cr.EmailAddr)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+		return
+	}
+	cr.EmailAddr = emailAddr
+
+	subscriber, err := storage.InsertNewSubscriber(cr)
+	if err != nil {
+		if isUniqueViolation(err) {
+			WriteJSON(w, http.StatusConflict, NewJsonResponse(false, nil, emailAddrAlreadySubscribed(cr.EmailAddr)))
+			return
+		}
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, subscriber, nil))
+}
+
+func handleGetAllSubscribersByUserID(w http.ResponseWriter, r *http.Request) {
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	createdAfter, err := QueryTime(r, QueryParamCreatedAfter)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+		return
+	}
+	createdBefore, err := QueryTime(r, QueryParamCreatedBefore)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	page, err := ParsePage(r, subscriberSortColumns, "-"+SortKeyCreatedAt)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	filter := SubscriberFilter{
+		EmailListID:        r.URL.Query().Get(QueryParamEmailListID),
+		SourceProviderName: ProviderName(r.URL.Query().Get(QueryParamSourceProviderName)),
+		CreatedAfter:       createdAfter,
+		CreatedBefore:      createdBefore,
+		Q:                  r.URL.Query().Get(QueryParamQ),
+	}
+	if !IsRootUser(user) {
+		filter.UserID = user.ID
+	}
+
+	subscribers, nextCursor, err := storage.GetAllSubscribersByFilter(filter, page)
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonPageResponse(subscribers, nextCursor))
+}
+
+// useSubscriber looks up the subscriber in the subscriberID route variable, making sure
+// it belongs to the user unless they are the root user. It writes the error response
+// itself, and returns nil if the request should go no further.
+func useSubscriber(w http.ResponseWriter, r *http.Request, user *User) *Subscriber {
+	subscriberID := mux.Vars(r)[MuxVarSubscriberID]
+	if subscriberID == "" {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, subscriberIDNotProvided()))
+		return nil
+	}
+
+	var (
+		subscriber *Subscriber
+		err        error
+	)
+	if IsRootUser(user) {
+		subscriber, err = storage.GetSubscriberByID(subscriberID)
+	} else {
+		subscriber, err = storage.GetSubscriberByIDAndUserID(subscriberID, user.ID)
+	}
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusNotFound, NewJsonResponse(false, nil, err))
+		return nil
+	}
+
+	return subscriber
+}
+
+func handleGetSubscriberByIDAndUserID(w http.ResponseWriter, r *http.Request) {
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	subscriber := useSubscriber(w, r, user)
+	if subscriber == nil {
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, subscriber, nil))
+}
+
+func handleUpdateSubscriberByIDAndUserID(w http.ResponseWriter, r *http.Request) {
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	subscriber := useSubscriber(w, r, user)
+	if subscriber == nil {
+		return
+	}
+
+	var ur SubscriberUpdateReq
+	if err := json.NewDecoder(r.Body).Decode(&ur); err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	if ur.EmailAddr != "" {
+		emailAddr, err := normalizeEmailAddr(ur.EmailAddr)
+		if err != nil {
+			WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+			return
+		}
+		ur.EmailAddr = emailAddr
+	}
+
+	if err := storage.UpdateSubscriberByID(subscriber.ID, ur); err != nil {
+		if isUniqueViolation(err) {
+			WriteJSON(w, http.StatusConflict, NewJsonResponse(false, nil, emailAddrAlreadySubscribed(ur.EmailAddr)))
+			return
+		}
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, nil, nil))
+}
+
+func handleDeleteSubscriberByIDAndUserID(w http.ResponseWriter, r *http.Request) {
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	subscriber := useSubscriber(w, r, user)
+	if subscriber == nil {
+		return
+	}
+
+	if err := storage.DeleteSubscriberByID(subscriber.ID); err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, nil, nil))
+}
+
+func handleInsertNewOutputByUserID(w http.ResponseWriter, r *http.Request) {
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	var cr OutputCreationReq
+	if err := json.NewDecoder(r.Body).Decode(&cr); err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+	if !IsRootUser(user) {
+		cr.UserID = user.ID
+	}
+
+	output, err := storage.InsertNewOutput(cr)
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, outputErrorStatus(err), NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, output, nil))
+}
+
+func handleGetAllOutputsByUserID(w http.ResponseWriter, r *http.Request) {
+	var (
+		outputs    []Output
+		nextCursor string
+		err        error
+	)
+
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	page, err := ParsePage(r, outputSortColumns, SortKeyCreatedAt)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	if IsRootUser(user) {
+		outputs, nextCursor, err = storage.GetAllOutputs(page)
+	} else {
+		outputs, nextCursor, err = storage.GetAllOutputsByUserID(user.ID, page)
+	}
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, outputIDNotProvided()))
+		return
+	}
+	WriteJSON(w, http.StatusOK, NewJsonPageResponse(makeOutputsData(outputs), nextCursor))
+}
+
+func handleGetOutputSchemas(w http.ResponseWriter, r *http.Request) {
+	if _, err := useProtectedRoute(w, r); err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, outputConfigSchemas, nil))
+}
+
+func handleGetOutputByIDAndUserID(w http.ResponseWriter, r *http.Request) {
+	var (
+		output Output
+		err    error
+	)
+
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	outputID := mux.Vars(r)[MuxVarOutputID]
+	if outputID == "" {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, outputIDNotProvided()))
+		return
+	}
+
+	if IsRootUser(user) {
+		output, err = storage.GetOutputByID(outputID)
+	} else {
+		output, err = storage.GetOutputByIDAndUserID(outputID, user.ID)
+	}
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, outputIDNotProvided()))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, output)
+}
+
+func handleUpdateOutputByIDAndUserID(w http.ResponseWriter, r *http.Request) {
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	outputID := mux.Vars(r)[MuxVarOutputID]
+	if outputID == "" {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, outputIDNotProvided()))
+		return
+	}
+
+	var ur OutputUpdateReq
+	if err := json.NewDecoder(r.Body).Decode(&ur); err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	userID := user.ID
+	if IsRootUser(user) {
+		output, err := storage.GetOutputByID(outputID)
+		if err != nil {
+			log.Print(err)
+			WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+			return
+		}
+		userID = output.GetUserID()
+	}
+
+	if err := storage.UpdateOutputByIDAndUserID(outputID, userID, ur); err != nil {
+		log.Print(err)
+		WriteJSON(w, outputErrorStatus(err), NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, nil, nil))
+}
+
+func handleDeleteOutputByIDAndUserID(w http.ResponseWriter, r *http.Request) {
+	var (
+		output Output
+		err    error
+	)
+
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	outputID := mux.Vars(r)[MuxVarOutputID]
+	if outputID == "" {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, outputIDNotProvided()))
+		return
+	}
+
+	if IsRootUser(user) {
+		output, err = storage.GetOutputByID(outputID)
+	} else {
+		output, err = storage.GetOutputByIDAndUserID(outputID, user.ID)
+	}
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusNotFound, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	if err := storage.DeleteOutputByID(output.GetID()); err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, nil, nil))
+}
+
+func handleReplayOutputByIDAndUserID(w http.ResponseWriter, r *http.Request) {
+	var (
+		output Output
+		err    error
+	)
+
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	outputID := mux.Vars(r)[MuxVarOutputID]
+	if outputID == "" {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, outputIDNotProvided()))
+		return
+	}
+
+	var rr OutputReplayReq
+	if err := json.NewDecoder(r.Body).Decode(&rr); err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+	if rr.EmailListID == "" {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, emailListIDNotProvided()))
+		return
+	}
+
+	if IsRootUser(user) {
+		output, err = storage.GetOutputByID(outputID)
+	} else {
+		output, err = storage.GetOutputByIDAndUserID(outputID, user.ID)
+	}
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	// Only replay lists that belong to the same user as the output
+	emailList, err := storage.GetEmailListByID(rr.EmailListID)
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+	if emailList.UserID != output.GetUserID() {
+		WriteUnauthorized(w)
+		return
+	}
+
+	subscribers, err := storage.GetAllSubscribersByEmailListIDAndCreatedAtRange(emailList.ID, rr.CreatedAfter, rr.CreatedBefore)
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	// Subscribers already waiting on a delivery to the output are skipped, so that
+	// replaying the same list twice in a row doesn't deliver anyone twice
+	active, err := storage.GetActiveOutboxJobSubscriberIDs(output.GetID())
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	// The jobs are spaced out so that a large replay doesn't hold up
+	// the deliveries of new subscribers that are queued after it
+	var (
+		now     = time.Now()
+		queued  = 0
+		results = []OutputReplayResult{}
+	)
+	for _, subscriber := range subscribers {
+		result := OutputReplayResult{SubscriberID: subscriber.ID, EmailAddr: subscriber.EmailAddr}
+
+		if active[subscriber.ID] {
+			result.Status = OutputReplayStatusSkipped
+			result.Reason = outboxJobAlreadyActive(output.GetID()).Error()
+			results = append(results, result)
+			continue
+		}
+
+		job := NewOutboxJob(output.GetID(), output.GetUserID(), *subscriber)
+		job.NextAttemptAt = now.Add(time.Duration(queued) * outboxOutputInterval)
+
+		// Each job is inserted on its own, so that one failing doesn't stop the rest being queued
+		if err := storage.InsertNewOutboxJobs([]*OutboxJob{job}); err != nil {
+			log.Print(err)
+			result.Status = OutputReplayStatusError
+			result.Error = err.Error()
+		} else {
+			result.Status = OutputReplayStatusQueued
+			result.JobID = job.ID
+			queued++
+		}
+		results = append(results, result)
+	}
+
+	WriteJSON(w, http.StatusAccepted, NewJsonResponse(true, results, nil))
+}
+
+func handleGetAllDeliveriesByOutputIDAndUserID(w http.ResponseWriter, r *http.Request) {
+	var (
+		deliveries []*Delivery
+		nextCursor string
+		err        error
+	)
+
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	outputID := mux.Vars(r)[MuxVarOutputID]
+	if outputID == "" {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, outputIDNotProvided()))
+		return
+	}
+
+	page, err := ParsePage(r, createdAtSortColumns, "-"+SortKeyCreatedAt)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	if IsRootUser(user) {
+		deliveries, nextCursor, err = storage.GetAllDeliveriesByOutputID(outputID, page)
+	} else {
+		deliveries, nextCursor, err = storage.GetAllDeliveriesByOutputIDAndUserID(outputID, user.ID, page)
+	}
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonPageResponse(deliveries, nextCursor))
+}
+
+func handleGetAllDeliveriesBySubscriberIDAndUserID(w http.ResponseWriter, r *http.Request) {
+	var (
+		deliveries []*Delivery
+		nextCursor string
+		err        error
+	)
+
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	subscriberID := mux.Vars(r)[MuxVarSubscriberID]
+	if subscriberID == "" {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, subscriberIDNotProvided()))
+		return
+	}
+
+	page, err := ParsePage(r, createdAtSortColumns, "-"+SortKeyCreatedAt)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	if IsRootUser(user) {
+		deliveries, nextCursor, err = storage.GetAllDeliveriesBySubscriberID(subscriberID, page)
+	} else {
+		deliveries, nextCursor, err = storage.GetAllDeliveriesBySubscriberIDAndUserID(subscriberID, user.ID, page)
+	}
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonPageResponse(deliveries, nextCursor))
+}
+
+func handleGetAllSubscriberJoinsBySubscriberIDAndUserID(w http.ResponseWriter, r *http.Request) {
+	var (
+		joins      []*SubscriberJoin
+		nextCursor string
+		err        error
+	)
+
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	subscriberID := mux.Vars(r)[MuxVarSubscriberID]
+	if subscriberID == "" {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, subscriberIDNotProvided()))
+		return
+	}
+
+	page, err := ParsePage(r, createdAtSortColumns, "-"+SortKeyCreatedAt)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	if IsRootUser(user) {
+		joins, nextCursor, err = storage.GetAllSubscriberJoinsBySubscriberID(subscriberID, page)
+	} else {
+		joins, nextCursor, err = storage.GetAllSubscriberJoinsBySubscriberIDAndUserID(subscriberID, user.ID, page)
+	}
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonPageResponse(joins, nextCursor))
+}
+
+func handleGetAllOutboxJobsByUserID(w http.ResponseWriter, r *http.Request) {
+	var (
+		jobs       []*OutboxJob
+		nextCursor string
+		err        error
+	)
+
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	status := OutboxJobStatus(r.URL.Query().Get(QueryParamStatus))
+
+	page, err := ParsePage(r, createdAtSortColumns, SortKeyCreatedAt)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	if IsRootUser(user) {
+		jobs, nextCursor, err = storage.GetAllOutboxJobs(status, page)
+	} else {
+		jobs, nextCursor, err = storage.GetAllOutboxJobsByUserID(user.ID, status, page)
+	}
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonPageResponse(jobs, nextCursor))
+}
+
+func handleDispatchOutbox(w http.ResponseWriter, r *http.Request) {
+	if err := dispatcher.DispatchDueWithin(outboxDispatchBudget); err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, nil, nil))
+}
+
+func handleRetryOutboxJobByIDAndUserID(w http.ResponseWriter, r *http.Request) {
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	jobID := mux.Vars(r)[MuxVarJobID]
+	if jobID == "" {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, jobIDNotProvided()))
+		return
+	}
+
+	job, err := storage.GetOutboxJobByID(jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusNotFound, NewJsonResponse(false, nil, err))
+		return
+	}
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+	if !IsRootUser(user) && job.UserID != user.ID {
+		WriteUnauthorized(w)
+		return
+	}
+
+	requeued, err := storage.RequeueOutboxJobByID(job.ID)
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+	if !requeued {
+		WriteJSON(w, http.StatusConflict, NewJsonResponse(false, nil, outboxJobNotRetryable(job.ID, job.Status)))
+		return
+	}
+
+	if err := dispatcher.DispatchByIDs([]string{job.ID}); err != nil {
+		log.Print(err)
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonResponse(true, nil, nil))
+}
+
+func handleGetAllProviderFailuresByEmailListIDAndUserID(w http.ResponseWriter, r *http.Request) {
+	user, err := useProtectedRoute(w, r)
+	if err != nil {
+		log.Print(err)
+		WriteUnauthorized(w)
+		return
+	}
+
+	emailListID := r.URL.Query().Get(QueryParamEmailListID)
+	if emailListID == "" {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, emailListIDNotProvided()))
+		return
+	}
+
+	page, err := ParsePage(r, createdAtSortColumns, "-"+SortKeyCreatedAt)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	emailList, err := storage.GetEmailListByID(emailListID)
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+	if !IsRootUser(user) && emailList.UserID != user.ID {
+		WriteUnauthorized(w)
+		return
+	}
+
+	failures, nextCursor, err := storage.GetAllProviderFailuresByEmailListID(emailList.ID, page)
+	if err != nil {
+		log.Print(err)
+		WriteJSON(w, http.StatusInternalServerError, NewJsonResponse(false, nil, err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewJsonPageResponse(failures, nextCursor))
 }
 
 func handleHealthz(w http.ResponseWriter, r *http.Request) {
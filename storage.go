@@ -2,11 +2,13 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -36,6 +38,10 @@ func (s *Storage) Init() error {
 		return err
 	}
 
+	if err := s.sealPlaintextOutputCredentials(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -100,7 +106,6 @@ var initTablesQueries = []string{
 		foreign key (user_id) references users(id)
 	)`,
 	sqlTrigger("update_subscribers_updated_at", "subscribers"),
-	// TODO: add empty strings as default values for params 1-3
 	`create table if not exists outputs (
 		id varchar(50) primary key,
 		user_id varchar(50),
@@ -114,6 +119,133 @@ var initTablesQueries = []string{
 		foreign key (user_id) references users(id)
 	)`,
 	sqlTrigger("update_outputs_updated_at", "outputs"),
+	`create table if not exists outbox_jobs (
+		id varchar(50) primary key,
+		output_id varchar(50),
+		user_id varchar(50),
+		subscriber jsonb,
+		status varchar(20),
+		attempts integer default 0,
+		max_attempts integer,
+		last_error text default '',
+		next_attempt_at timestamp default current_timestamp,
+		created_at timestamp default current_timestamp,
+		updated_at timestamp default current_timestamp,
+		foreign key (user_id) references users(id)
+	)`,
+	`create index if not exists outbox_jobs_status_next_attempt_at_idx on outbox_jobs (status, next_attempt_at)`,
+	sqlTrigger("update_outbox_jobs_updated_at", "outbox_jobs"),
+	`create table if not exists deliveries (
+		id varchar(50) primary key,
+		outbox_job_id varchar(50),
+		output_id varchar(50),
+		user_id varchar(50),
+		subscriber_id varchar(50),
+		success boolean,
+		status_code integer,
+		error text,
+		latency_ms bigint,
+		created_at timestamp default current_timestamp,
+		foreign key (user_id) references users(id)
+	)`,
+	`create index if not exists deliveries_output_id_idx on deliveries (output_id)`,
+	`create index if not exists deliveries_subscriber_id_idx on deliveries (subscriber_id)`,
+	`create table if not exists oauth_states (
+		state varchar(100) primary key,
+		email_list_id varchar(50),
+		provider_name varchar(50),
+		output_ids text[],
+		redirect_url text,
+		created_at timestamp default current_timestamp
+	)`,
+	`create index if not exists oauth_states_created_at_idx on oauth_states (created_at)`,
+	// Added after oauth_states was first released, so existing tables need the column too
+	`alter table oauth_states add column if not exists code_verifier varchar(128) default ''`,
+	// user_id has no foreign key, since a failure can be recorded for a campaign
+	// whose email list no longer exists
+	`create table if not exists provider_failures (
+		id varchar(50) primary key,
+		email_list_id varchar(50),
+		user_id varchar(50),
+		provider_name varchar(50),
+		stage varchar(20),
+		status_code integer,
+		error text,
+		created_at timestamp default current_timestamp
+	)`,
+	`create index if not exists provider_failures_email_list_id_idx on provider_failures (email_list_id)`,
+	`alter table email_lists add column if not exists unverified_email_policy varchar(20) default 'accept'`,
+	`alter table subscribers add column if not exists email_verified boolean default false`,
+	`alter table subscribers add column if not exists tags text[] default '{}'`,
+	`alter table subscribers add column if not exists provider_subject_id varchar(255) default ''`,
+	`alter table subscribers add column if not exists given_name varchar(100) default ''`,
+	`alter table subscribers add column if not exists family_name varchar(100) default ''`,
+	`alter table subscribers add column if not exists avatar_url text default ''`,
+	`alter table subscribers add column if not exists locale varchar(20) default ''`,
+	`alter table subscribers add column if not exists raw_profile jsonb default '{}'`,
+	// Subscribers are unique per email list, so the same person can join several lists
+	`alter table subscribers drop constraint if exists subscribers_email_addr_key`,
+	`drop index if exists subscribers_email_list_id_email_addr_idx`,
+	`create table if not exists subscriber_joins (
+		id varchar(50) primary key,
+		subscriber_id varchar(50),
+		email_list_id varchar(50),
+		user_id varchar(50),
+		provider_name varchar(50),
+		rejoin boolean,
+		created_at timestamp default current_timestamp,
+		foreign key (user_id) references users(id)
+	)`,
+	`create index if not exists subscriber_joins_subscriber_id_idx on subscriber_joins (subscriber_id)`,
+	`alter table subscribers add column if not exists archived_at timestamp`,
+	`alter table subscribers add column if not exists archived_email_list_id varchar(50) default ''`,
+	// Addresses are unique per list ignoring case. Lists that already hold the
+	// same address in different cases keep the oldest subscriber, and the
+	// newer ones are archived the same way deleting a list archives them.
+	`update subscribers s
+		set archived_at = now(), archived_email_list_id = s.email_list_id, email_list_id = null
+		where s.email_list_id is not null and exists (
+			select 1 from subscribers o
+			where o.email_list_id = s.email_list_id
+			and lower(o.email_addr) = lower(s.email_addr)
+			and (o.created_at, o.id) < (s.created_at, s.id)
+		)
+	`,
+	// Replaces the index of the same columns that was created under the _idx name
+	`drop index if exists subscribers_email_list_id_lower_email_addr_idx`,
+	`create unique index if not exists subscribers_email_list_id_lower_email_addr_key on subscribers (email_list_id, lower(email_addr))`,
+	// The outputs that campaigns without o= params deliver to
+	`create table if not exists email_list_outputs (
+		email_list_id varchar(50),
+		output_id varchar(50),
+		created_at timestamp default current_timestamp,
+		primary key (email_list_id, output_id),
+		foreign key (email_list_id) references email_lists(id),
+		foreign key (output_id) references outputs(id)
+	)`,
+	`create index if not exists email_list_outputs_output_id_idx on email_list_outputs (output_id)`,
+	// Output settings moved from list_id and param_1-3 to a config object
+	// that is validated against the schema for the output name
+	`alter table outputs add column if not exists config jsonb default '{}'`,
+	`do $$
+	begin
+		if exists (select 1 from information_schema.columns where table_name = 'outputs' and column_name = 'param_1') then
+			update outputs set config = jsonb_strip_nulls(case output_name
+				when 'aweber' then jsonb_build_object('listId', list_id, 'adTracking', nullif(param_1, ''))
+				when 'brevo' then jsonb_build_object('listId', list_id)
+				when 'resend' then jsonb_build_object('audienceId', list_id)
+				when 'telegram' then jsonb_build_object('chatId', list_id, 'msgFmt', param_1)
+				when 'webhook' then jsonb_build_object('urlFmt', param_1)
+				else '{}'::jsonb
+			end);
+		end if;
+	end $$`,
+	`alter table outputs drop column if exists list_id`,
+	`alter table outputs drop column if exists param_1`,
+	`alter table outputs drop column if exists param_2`,
+	`alter table outputs drop column if exists param_3`,
+	// The write-only fields of output configs, encrypted with a key derived from CRYPTO_SECRET
+	`alter table outputs add column if not exists credentials bytea`,
 }
 
 func (s *Storage) initTables() error {
@@ -161,23 +293,28 @@ func (s *Storage) InsertNewUser(cr UserCreationReq) (*User, error) {
 	return user, nil
 }
 
-func (s *Storage) GetAllUsers() ([]*User, error) {
-	rows, err := s.db.Query("select * from users")
+func (s *Storage) GetAllUsers(page Page) ([]*User, string, error) {
+	query, args := page.pageQuery("select * from users", nil, nil)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
+	defer rows.Close()
 
 	users := []*User{}
 	for rows.Next() {
 		user, err := scanIntoUser(rows)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 		users = append(users, user)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
 
-	return users, nil
+	return pageResult(users, page, (*User).pageCursor)
 }
 
 func (s *Storage) GetUserByID(id string) (*User, error) {
@@ -264,20 +401,27 @@ func scanIntoUser(rows *sql.Rows) (*User, error) {
 	return user, err
 }
 
+const emailListColumns = "id, user_id, name, unverified_email_policy, created_at, updated_at"
+
 func (s *Storage) InsertNewEmailList(cr EmailListCreationReq) (*EmailList, error) {
-	emailList := NewEmailList(cr.UserID, cr.Name)
+	if cr.UnverifiedEmailPolicy != "" && !validUnverifiedEmailPolicy(cr.UnverifiedEmailPolicy) {
+		return nil, invalidUnverifiedEmailPolicy(cr.UnverifiedEmailPolicy)
+	}
+
+	emailList := NewEmailList(cr.UserID, cr.Name, cr.UnverifiedEmailPolicy)
 
 	query := `
 		insert into email_lists
-		(id, user_id, name, created_at, updated_at)
+		(id, user_id, name, unverified_email_policy, created_at, updated_at)
 		values
-		($1, $2, $3, $4, $5)
+		($1, $2, $3, $4, $5, $6)
 	`
 	if _, err := s.db.Query(
 		query,
 		emailList.ID,
 		emailList.UserID,
 		emailList.Name,
+		emailList.UnverifiedEmailPolicy,
 		emailList.CreatedAt,
 		emailList.UpdatedAt,
 	); err != nil {
@@ -287,46 +431,54 @@ func (s *Storage) InsertNewEmailList(cr EmailListCreationReq) (*EmailList, error
 	return emailList, nil
 }
 
-func (s *Storage) GetAllEmailLists() ([]*EmailList, error) {
-	rows, err := s.db.Query("select * from email_lists")
+func (s *Storage) GetAllEmailLists(page Page) ([]*EmailList, string, error) {
+	query, args := page.pageQuery(fmt.Sprintf("select %s from email_lists", emailListColumns), nil, nil)
+	return s.queryEmailListPage(page, query, args...)
+}
+
+func (s *Storage) GetAllEmailListsByUserID(userID string, page Page) ([]*EmailList, string, error) {
+	query, args := page.pageQuery(fmt.Sprintf("select %s from email_lists", emailListColumns), []string{"user_id = $1"}, []any{userID})
+	return s.queryEmailListPage(page, query, args...)
+}
+
+func (s *Storage) queryEmailListPage(page Page, query string, args ...any) ([]*EmailList, string, error) {
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
+	defer rows.Close()
 
 	emailLists := []*EmailList{}
 	for rows.Next() {
 		emailList, err := scanIntoEmailList(rows)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 		emailLists = append(emailLists, emailList)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
 
-	return emailLists, nil
+	return pageResult(emailLists, page, (*EmailList).pageCursor)
 }
 
-func (s *Storage) GetAllEmailListsByUserID(userID string) ([]*EmailList, error) {
-	rows, err := s.db.Query("select * from email_lists where user_id = $1", userID)
+func (s *Storage) GetEmailListByIDAndUserID(id string, userID string) (*EmailList, error) {
+	rows, err := s.db.Query(fmt.Sprintf("select %s from email_lists where id = $1 and user_id = $2", emailListColumns), id, userID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	emailLists := []*EmailList{}
 	for rows.Next() {
-		emailList, err := scanIntoEmailList(rows)
-		if err != nil {
-			return nil, err
-		}
-
-		emailLists = append(emailLists, emailList)
+		return scanIntoEmailList(rows)
 	}
-
-	return emailLists, nil
+	return nil, fmt.Errorf("email list %s not found", id)
 }
 
 func (s *Storage) GetEmailListByID(id string) (*EmailList, error) {
-	rows, err := s.db.Query("select * from email_lists where id = $1", id)
+	rows, err := s.db.Query(fmt.Sprintf("select %s from email_lists where id = $1", emailListColumns), id)
 	if err != nil {
 		return nil, err
 	}
@@ -340,15 +492,25 @@ func (s *Storage) UpdateEmailListByID(id string, ur EmailListUpdateReq) error {
 	query := "update email_lists set "
 	args := []interface{}{}
 
+	sets := []string{}
+
 	if ur.Name != "" {
-		query += "name = $1"
 		args = append(args, ur.Name)
+		sets = append(sets, fmt.Sprintf("name = $%d", len(args)))
+	}
+	if ur.UnverifiedEmailPolicy != "" {
+		if !validUnverifiedEmailPolicy(ur.UnverifiedEmailPolicy) {
+			return invalidUnverifiedEmailPolicy(ur.UnverifiedEmailPolicy)
+		}
+		args = append(args, ur.UnverifiedEmailPolicy)
+		sets = append(sets, fmt.Sprintf("unverified_email_policy = $%d", len(args)))
 	}
 
 	if len(args) == 0 {
 		return fmt.Errorf("no update fields specified")
 	}
 
+	query += strings.Join(sets, ", ")
 	query += " where id = $" + fmt.Sprintf("%d", len(args)+1)
 	args = append(args, id)
 
@@ -356,9 +518,46 @@ func (s *Storage) UpdateEmailListByID(id string, ur EmailListUpdateReq) error {
 	return err
 }
 
-func (s *Storage) DeleteEmailListByID(id string) error {
-	_, err := s.db.Query("delete from email_lists where id = $1", id)
-	return err
+// DeleteEmailListByID deletes the email list, along with its subscribers or after archiving them,
+// depending on mode. Campaign visits that are still in flight for the list are dropped too.
+func (s *Storage) DeleteEmailListByID(id string, mode EmailListDeleteMode) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	switch mode {
+	case EmailListDeleteModeArchive:
+		if _, err := tx.Exec(`
+			update subscribers
+			set archived_at = now(), archived_email_list_id = email_list_id, email_list_id = null
+			where email_list_id = $1
+		`, id); err != nil {
+			return err
+		}
+	case EmailListDeleteModeCascade:
+		if _, err := tx.Exec("delete from subscriber_joins where email_list_id = $1", id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("delete from subscribers where email_list_id = $1", id); err != nil {
+			return err
+		}
+	default:
+		return invalidEmailListDeleteMode(mode)
+	}
+
+	if _, err := tx.Exec("delete from oauth_states where email_list_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("delete from email_list_outputs where email_list_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("delete from email_lists where id = $1", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func scanIntoEmailList(rows *sql.Rows) (*EmailList, error) {
@@ -367,6 +566,7 @@ func scanIntoEmailList(rows *sql.Rows) (*EmailList, error) {
 		&emailList.ID,
 		&emailList.UserID,
 		&emailList.Name,
+		&emailList.UnverifiedEmailPolicy,
 		&emailList.CreatedAt,
 		&emailList.UpdatedAt,
 	)
@@ -375,14 +575,31 @@ func scanIntoEmailList(rows *sql.Rows) (*EmailList, error) {
 
 func (s *Storage) InsertNewSubscriber(cr SubscriberCreationReq) (*Subscriber, error) {
 	subscriber := NewSubscriber(cr.EmailListID, cr.UserID, cr.SourceProviderName, cr.Name, cr.EmailAddr)
+	subscriber.EmailVerified = cr.EmailVerified
+	subscriber.GivenName = cr.GivenName
+	subscriber.FamilyName = cr.FamilyName
+	if cr.Tags != nil {
+		subscriber.Tags = cr.Tags
+	}
+	if err := s.InsertSubscriber(subscriber); err != nil {
+		return nil, err
+	}
+	return subscriber, nil
+}
+
+// email_list_id is null for archived subscribers
+const subscriberColumns = "id, coalesce(email_list_id, ''), user_id, source_provider_name, name, email_addr, email_verified, tags, " +
+	"provider_subject_id, given_name, family_name, avatar_url, locale, raw_profile, archived_at, archived_email_list_id, created_at, updated_at"
 
+func (s *Storage) InsertSubscriber(subscriber *Subscriber) error {
 	query := `
 		insert into subscribers
-		(id, email_list_id, user_id, source_provider_name, name, email_addr, created_at, updated_at)
+		(id, email_list_id, user_id, source_provider_name, name, email_addr, email_verified, tags,
+		provider_subject_id, given_name, family_name, avatar_url, locale, raw_profile, created_at, updated_at)
 		values
-		($1, $2, $3, $4, $5, $6, $7, $8)
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 	`
-	if _, err := s.db.Query(
+	if _, err := s.db.Exec(
 		query,
 		subscriber.ID,
 		subscriber.EmailListID,
@@ -390,39 +607,323 @@ func (s *Storage) InsertNewSubscriber(cr SubscriberCreationReq) (*Subscriber, er
 		subscriber.SourceProviderName,
 		subscriber.Name,
 		subscriber.EmailAddr,
+		subscriber.EmailVerified,
+		pq.Array(subscriber.Tags),
+		subscriber.ProviderSubjectID,
+		subscriber.GivenName,
+		subscriber.FamilyName,
+		subscriber.AvatarURL,
+		subscriber.Locale,
+		jsonObjectOrEmpty(subscriber.RawProfile),
 		subscriber.CreatedAt,
 		subscriber.UpdatedAt,
 	); err != nil {
-		return nil, err
+		return err
 	}
 
-	return subscriber, nil
+	return nil
 }
 
-func (s *Storage) GetAllSubscribers() ([]*Subscriber, error) {
-	rows, err := s.db.Query("select * from subscribers")
+// UpsertSubscriber adds the subscriber to their email list, or refreshes the name of
+// the existing subscriber with the same email address on that list, records the join,
+// and queues an outbox job for each output. It all happens in one transaction, so a
+// subscriber is never saved without their deliveries being queued.
+// The subscriber's ID and CreatedAt are set to those of the stored row.
+func (s *Storage) UpsertSubscriber(subscriber *Subscriber, providerName ProviderName, outputIDs []string) (*SubscriberJoin, []*OutboxJob, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// xmax is only zero for rows that were inserted rather than updated
+	query := `
+		insert into subscribers
+		(id, email_list_id, user_id, source_provider_name, name, email_addr, email_verified, tags,
+		provider_subject_id, given_name, family_name, avatar_url, locale, raw_profile, created_at, updated_at)
+		values
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		on conflict (email_list_id, lower(email_addr)) do update
+		set name = excluded.name, updated_at = excluded.updated_at
+		returning id, created_at, xmax = 0
+	`
+	var inserted bool
+	if err := tx.QueryRow(
+		query,
+		subscriber.ID,
+		subscriber.EmailListID,
+		subscriber.UserID,
+		subscriber.SourceProviderName,
+		subscriber.Name,
+		subscriber.EmailAddr,
+		subscriber.EmailVerified,
+		pq.Array(subscriber.Tags),
+		subscriber.ProviderSubjectID,
+		subscriber.GivenName,
+		subscriber.FamilyName,
+		subscriber.AvatarURL,
+		subscriber.Locale,
+		jsonObjectOrEmpty(subscriber.RawProfile),
+		subscriber.CreatedAt,
+		subscriber.UpdatedAt,
+	).Scan(&subscriber.ID, &subscriber.CreatedAt, &inserted); err != nil {
+		return nil, nil, err
+	}
+
+	join := NewSubscriberJoin(*subscriber, providerName, !inserted)
+	if _, err := tx.Exec(
+		`insert into subscriber_joins
+		(id, subscriber_id, email_list_id, user_id, provider_name, rejoin, created_at)
+		values
+		($1, $2, $3, $4, $5, $6, $7)`,
+		join.ID,
+		join.SubscriberID,
+		join.EmailListID,
+		join.UserID,
+		join.ProviderName,
+		join.Rejoin,
+		join.CreatedAt,
+	); err != nil {
+		return nil, nil, err
+	}
+
+	// The jobs are made after the upsert, so that they carry the ID of the stored subscriber
+	jobs := []*OutboxJob{}
+	for _, outputID := range outputIDs {
+		jobs = append(jobs, NewOutboxJob(outputID, subscriber.UserID, *subscriber))
+	}
+	if err := insertOutboxJobs(tx, jobs); err != nil {
+		return nil, nil, err
+	}
+
+	return join, jobs, tx.Commit()
+}
+
+// ImportSubscribers inserts the subscribers in batches inside a single transaction,
+// skipping any whose email address is already on their email list, ignoring case.
+// The subscribers that were inserted are returned.
+func (s *Storage) ImportSubscribers(subscribers []*Subscriber) ([]*Subscriber, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	inserted := []*Subscriber{}
+	for start := 0; start < len(subscribers); start += importBatchSize {
+		batch := subscribers[start:min(start+importBatchSize, len(subscribers))]
+
+		values := make([]string, len(batch))
+		args := make([]any, 0, len(batch)*7)
+		for i, subscriber := range batch {
+			n := i * 7
+			values[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d::timestamp)", n+1, n+2, n+3, n+4, n+5, n+6, n+7)
+			args = append(
+				args,
+				subscriber.ID,
+				subscriber.EmailListID,
+				subscriber.UserID,
+				subscriber.SourceProviderName,
+				subscriber.Name,
+				subscriber.EmailAddr,
+				subscriber.CreatedAt,
+			)
+		}
+
+		query := fmt.Sprintf(`
+			insert into subscribers
+			(id, email_list_id, user_id, source_provider_name, name, email_addr, created_at, updated_at)
+			select v.id, v.email_list_id, v.user_id, v.source_provider_name, v.name, v.email_addr, v.created_at, v.created_at
+			from (values %s) as v (id, email_list_id, user_id, source_provider_name, name, email_addr, created_at)
+			on conflict (email_list_id, lower(email_addr)) do nothing
+			returning id
+		`, strings.Join(values, ", "))
+
+		rows, err := tx.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		insertedIDs := make(map[string]bool)
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			insertedIDs[id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		for _, subscriber := range batch {
+			if insertedIDs[subscriber.ID] {
+				inserted = append(inserted, subscriber)
+			}
+		}
+	}
+
+	return inserted, tx.Commit()
+}
+
+// jsonObjectOrEmpty stores an unset jsonb object column as an empty object rather than null
+func jsonObjectOrEmpty(obj json.RawMessage) []byte {
+	if len(obj) == 0 {
+		return []byte("{}")
+	}
+	return obj
+}
+
+// GetAllSubscribersByFilter returns a page of the subscribers matching every field that is set on the filter.
+func (s *Storage) GetAllSubscribersByFilter(filter SubscriberFilter, page Page) ([]*Subscriber, string, error) {
+	var (
+		conds = []string{}
+		args  = []any{}
+	)
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.UserID != "" {
+		where("user_id = $%d", filter.UserID)
+	}
+	if filter.EmailListID != "" {
+		where("email_list_id = $%d", filter.EmailListID)
+	}
+	if filter.SourceProviderName != "" {
+		where("source_provider_name = $%d", filter.SourceProviderName)
+	}
+	if filter.CreatedAfter != nil {
+		where("created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		where("created_at <= $%d", *filter.CreatedBefore)
+	}
+	if filter.Q != "" {
+		args = append(args, "%"+likeEscaper.Replace(filter.Q)+"%")
+		conds = append(conds, fmt.Sprintf("(email_addr ilike $%d or name ilike $%d)", len(args), len(args)))
+	}
+
+	query, args := page.pageQuery(fmt.Sprintf("select %s from subscribers", subscriberColumns), conds, args)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
 
 	subscribers := []*Subscriber{}
 	for rows.Next() {
 		subscriber, err := scanIntoSubscriber(rows)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 		subscribers = append(subscribers, subscriber)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	return pageResult(subscribers, page, (*Subscriber).pageCursor)
+}
+
+// likeEscaper escapes the wildcards in a search term, so that it only matches literally in a like pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (s *Storage) GetSubscriberByID(id string) (*Subscriber, error) {
+	return s.getSubscriber(fmt.Sprintf("select %s from subscribers where id = $1", subscriberColumns), id)
+}
+
+func (s *Storage) GetSubscriberByIDAndUserID(id string, userID string) (*Subscriber, error) {
+	return s.getSubscriber(fmt.Sprintf("select %s from subscribers where id = $1 and user_id = $2", subscriberColumns), id, userID)
+}
+
+func (s *Storage) getSubscriber(query string, args ...any) (*Subscriber, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		return scanIntoSubscriber(rows)
+	}
+	return nil, fmt.Errorf("subscriber %s not found", args[0])
+}
+
+func (s *Storage) UpdateSubscriberByID(id string, ur SubscriberUpdateReq) error {
+	var (
+		sets = []string{}
+		args = []any{}
+	)
+	set := func(column string, arg any) {
+		args = append(args, arg)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if ur.Name != "" {
+		set("name", ur.Name)
+	}
+	if ur.EmailAddr != "" {
+		set("email_addr", ur.EmailAddr)
+	}
+	if ur.GivenName != "" {
+		set("given_name", ur.GivenName)
+	}
+	if ur.FamilyName != "" {
+		set("family_name", ur.FamilyName)
+	}
+	if ur.Tags != nil {
+		set("tags", pq.Array(ur.Tags))
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("no update fields specified")
+	}
+
+	args = append(args, id)
+	query := fmt.Sprintf("update subscribers set %s where id = $%d", strings.Join(sets, ", "), len(args))
+
+	_, err := s.db.Exec(query, args...)
+	return err
+}
+
+func (s *Storage) DeleteSubscriberByID(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	return subscribers, nil
+	if _, err := tx.Exec("delete from subscriber_joins where subscriber_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("delete from subscribers where id = $1", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (s *Storage) GetAllSubscribersByUserID(userID string) ([]*Subscriber, error) {
-	rows, err := s.db.Query("select * from subscribers where user_id = $1", userID)
+// GetAllSubscribersByEmailListIDAndCreatedAtRange returns the subscribers of an email list,
+// oldest first. A nil createdAfter or createdBefore leaves that side of the range open.
+func (s *Storage) GetAllSubscribersByEmailListIDAndCreatedAtRange(emailListID string, createdAfter *time.Time, createdBefore *time.Time) ([]*Subscriber, error) {
+	query := fmt.Sprintf(`
+		select %s from subscribers
+		where email_list_id = $1
+		and ($2::timestamp is null or created_at >= $2)
+		and ($3::timestamp is null or created_at <= $3)
+		order by created_at
+	`, subscriberColumns)
+	rows, err := s.db.Query(query, emailListID, createdAfter, createdBefore)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	subscribers := []*Subscriber{}
 	for rows.Next() {
@@ -434,11 +935,14 @@ func (s *Storage) GetAllSubscribersByUserID(userID string) ([]*Subscriber, error
 		subscribers = append(subscribers, subscriber)
 	}
 
-	return subscribers, nil
+	return subscribers, rows.Err()
 }
 
 func scanIntoSubscriber(rows *sql.Rows) (*Subscriber, error) {
-	subscriber := new(Subscriber)
+	var (
+		subscriber = new(Subscriber)
+		rawProfile []byte
+	)
 	err := rows.Scan(
 		&subscriber.ID,
 		&subscriber.EmailListID,
@@ -446,32 +950,55 @@ func scanIntoSubscriber(rows *sql.Rows) (*Subscriber, error) {
 		&subscriber.SourceProviderName,
 		&subscriber.Name,
 		&subscriber.EmailAddr,
+		&subscriber.EmailVerified,
+		pq.Array(&subscriber.Tags),
+		&subscriber.ProviderSubjectID,
+		&subscriber.GivenName,
+		&subscriber.FamilyName,
+		&subscriber.AvatarURL,
+		&subscriber.Locale,
+		&rawProfile,
+		&subscriber.ArchivedAt,
+		&subscriber.ArchivedEmailListID,
 		&subscriber.CreatedAt,
 		&subscriber.UpdatedAt,
 	)
+	subscriber.RawProfile = rawProfile
 	return subscriber, err
 }
 
+const outputColumns = "id, user_id, output_name, config, credentials, created_at, updated_at"
+
 func (s *Storage) InsertNewOutput(cr OutputCreationReq) (Output, error) {
+	if err := ValidateOutputConfig(cr.OutputName, cr.Config); err != nil {
+		return nil, err
+	}
+
 	id := NewUUID()
 	now := time.Now()
-	output := makeOutput(id, cr.UserID, cr.OutputName, cr.ListID, cr.Param1, cr.Param2, cr.Param3, now, now)
+	output, err := makeOutput(id, cr.UserID, cr.OutputName, cr.Config, now, now)
+	if err != nil {
+		return nil, err
+	}
+
+	config, credentials, err := sealOutputConfig(id, cr.OutputName, cr.Config)
+	if err != nil {
+		return nil, err
+	}
 
 	query := `
 		insert into outputs
-		(id, user_id, output_name, list_id, param_1, param_2, param_3, created_at, updated_at)
+		(id, user_id, output_name, config, credentials, created_at, updated_at)
 		values
-		($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		($1, $2, $3, $4, $5, $6, $7)
 	`
-	if _, err := s.db.Query(
+	if _, err := s.db.Exec(
 		query,
 		id,
 		cr.UserID,
 		output.OutputName(),
-		cr.ListID,
-		cr.Param1,
-		cr.Param2,
-		cr.Param3,
+		jsonObjectOrEmpty(config),
+		credentials,
 		now,
 		now,
 	); err != nil {
@@ -481,44 +1008,40 @@ func (s *Storage) InsertNewOutput(cr OutputCreationReq) (Output, error) {
 	return output, nil
 }
 
-func (s *Storage) GetAllOutputs() ([]Output, error) {
-	outputs := []Output{}
-	rows, err := s.db.Query("select * from outputs")
-	if err != nil {
-		return outputs, err
-	}
-
-	for rows.Next() {
-		output, err := scanIntoOutput(rows)
-		if err != nil {
-			return nil, err
-		}
-		outputs = append(outputs, output)
-	}
+func (s *Storage) GetAllOutputs(page Page) ([]Output, string, error) {
+	query, args := page.pageQuery(fmt.Sprintf("select %s from outputs", outputColumns), nil, nil)
+	return s.queryOutputPage(page, query, args...)
+}
 
-	return outputs, nil
+func (s *Storage) GetAllOutputsByUserID(userID string, page Page) ([]Output, string, error) {
+	query, args := page.pageQuery(fmt.Sprintf("select %s from outputs", outputColumns), []string{"user_id = $1"}, []any{userID})
+	return s.queryOutputPage(page, query, args...)
 }
 
-func (s *Storage) GetAllOutputsByUserID(userID string) ([]Output, error) {
-	outputs := []Output{}
-	rows, err := s.db.Query("select * from outputs where user_id = $1", userID)
+func (s *Storage) queryOutputPage(page Page, query string, args ...any) ([]Output, string, error) {
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return outputs, err
+		return nil, "", err
 	}
+	defer rows.Close()
 
+	outputs := []Output{}
 	for rows.Next() {
 		output, err := scanIntoOutput(rows)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		outputs = append(outputs, output)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
 
-	return outputs, nil
+	return pageResult(outputs, page, outputPageCursor)
 }
 
 func (s *Storage) GetOutputByID(id string) (Output, error) {
-	rows, err := s.db.Query("select * from outputs where id = $1", id)
+	rows, err := s.db.Query(fmt.Sprintf("select %s from outputs where id = $1", outputColumns), id)
 	if err != nil {
 		return nil, err
 	}
@@ -529,7 +1052,7 @@ func (s *Storage) GetOutputByID(id string) (Output, error) {
 }
 
 func (s *Storage) GetOutputByIDAndUserID(id string, userID string) (Output, error) {
-	rows, err := s.db.Query("select * from outputs where id = $1 and user_id = $2", id, userID)
+	rows, err := s.db.Query(fmt.Sprintf("select %s from outputs where id = $1 and user_id = $2", outputColumns), id, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -539,75 +1062,154 @@ func (s *Storage) GetOutputByIDAndUserID(id string, userID string) (Output, erro
 	return nil, fmt.Errorf("output %s not found", id)
 }
 
+// UpdateOutputByIDAndUserID merges the config of the update into the output's
+// current config, or replaces it if the output name changes, and validates the result.
 func (s *Storage) UpdateOutputByIDAndUserID(id string, userID string, ur OutputUpdateReq) error {
+	if ur.OutputName == "" && len(ur.Config) == 0 {
+		return fmt.Errorf("no update fields specified")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	var (
-		setClauses []string
-		args       []interface{}
+		outputName  OutputName
+		config      []byte
+		credentials []byte
 	)
+	if err := tx.QueryRow(
+		"select output_name, config, credentials from outputs where id = $1 and user_id = $2 for update",
+		id,
+		userID,
+	).Scan(&outputName, &config, &credentials); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("output %s not found", id)
+		}
+		return err
+	}
 
-	if ur.OutputName != "" {
-		clause := "output_name = $" + fmt.Sprintf("%d", len(args)+1)
-		setClauses = append(setClauses, clause)
-		args = append(args, ur.OutputName)
+	// Merging into the decrypted config lets an update leave the credentials as they are
+	if config, err = openOutputConfig(id, config, credentials); err != nil {
+		return err
 	}
-	if ur.ListID != "" {
-		clause := fmt.Sprintf("list_id = $%d", len(args)+1)
-		setClauses = append(setClauses, clause)
-		args = append(args, ur.ListID)
+
+	newConfig := json.RawMessage(ur.Config)
+	if ur.OutputName == "" || ur.OutputName == outputName {
+		ur.OutputName = outputName
+		if newConfig, err = mergeOutputConfig(config, ur.Config); err != nil {
+			return &OutputConfigError{OutputName: outputName, Err: err}
+		}
 	}
-	if ur.Param1 != "" {
-		clause := fmt.Sprintf("param_1 = $%d", len(args)+1)
-		setClauses = append(setClauses, clause)
-		args = append(args, ur.Param1)
+	if err := ValidateOutputConfig(ur.OutputName, newConfig); err != nil {
+		return err
 	}
-	if ur.Param2 != "" {
-		clause := fmt.Sprintf(" param_2 = $%d", len(args)+1)
-		setClauses = append(setClauses, clause)
-		args = append(args, ur.Param2)
+
+	newConfig, credentials, err = sealOutputConfig(id, ur.OutputName, newConfig)
+	if err != nil {
+		return err
 	}
-	if ur.Param3 != "" {
-		clause := fmt.Sprintf(" param_3 = $%d", len(args)+1)
-		setClauses = append(setClauses, clause)
-		args = append(args, ur.Param3)
+
+	if _, err := tx.Exec(
+		"update outputs set output_name = $1, config = $2, credentials = $3 where id = $4",
+		ur.OutputName,
+		jsonObjectOrEmpty(newConfig),
+		credentials,
+		id,
+	); err != nil {
+		return err
 	}
 
-	if len(setClauses) == 0 || len(args) == 0 {
-		return fmt.Errorf("no update fields specified")
+	return tx.Commit()
+}
+
+// DeleteOutputByID deletes the output and detaches it from any email lists. Its
+// pending outbox jobs can never be delivered, so they are moved to dead letter.
+func (s *Storage) DeleteOutputByID(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("delete from email_list_outputs where output_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"update outbox_jobs set status = $1, last_error = $2 where output_id = $3 and status = $4",
+		OutboxJobStatusDead,
+		outputDeleted(id).Error(),
+		id,
+		OutboxJobStatusPending,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("delete from outputs where id = $1", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAllOutputsByEmailListID returns the default outputs of the email list, in the order they were added
+func (s *Storage) GetAllOutputsByEmailListID(emailListID string) ([]Output, error) {
+	rows, err := s.db.Query(`
+		select o.id, o.user_id, o.output_name, o.config, o.credentials, o.created_at, o.updated_at from outputs o
+		join email_list_outputs elo on elo.output_id = o.id
+		where elo.email_list_id = $1
+		order by elo.created_at, o.id
+	`, emailListID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	outputs := []Output{}
+	for rows.Next() {
+		output, err := scanIntoOutput(rows)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, output)
 	}
 
-	query := fmt.Sprintf(
-		"update outputs set %s where id = $%d and user_id = $%d",
-		strings.Join(setClauses, ", "),
-		len(args)+1,
-		len(args)+2,
+	return outputs, rows.Err()
+}
+
+func (s *Storage) InsertEmailListOutput(emailListID string, outputID string) error {
+	_, err := s.db.Exec(
+		"insert into email_list_outputs (email_list_id, output_id, created_at) values ($1, $2, $3) on conflict do nothing",
+		emailListID,
+		outputID,
+		time.Now(),
 	)
-	args = append(args, id, userID)
+	return err
+}
 
-	_, err := s.db.Exec(query, args...)
+func (s *Storage) DeleteEmailListOutput(emailListID string, outputID string) error {
+	_, err := s.db.Exec("delete from email_list_outputs where email_list_id = $1 and output_id = $2", emailListID, outputID)
 	return err
 }
 
 func scanIntoOutput(rows *sql.Rows) (Output, error) {
 	var (
-		id         string
-		userID     string
-		outputName OutputName
-		listID     string
-		param1     string
-		param2     string
-		param3     string
-		createdAt  time.Time
-		updatedAt  time.Time
+		id          string
+		userID      string
+		outputName  OutputName
+		config      []byte
+		credentials []byte
+		createdAt   time.Time
+		updatedAt   time.Time
 	)
 
 	err := rows.Scan(
 		&id,
 		&userID,
 		&outputName,
-		&listID,
-		&param1,
-		&param2,
-		&param3,
+		&config,
+		&credentials,
 		&createdAt,
 		&updatedAt,
 	)
@@ -615,5 +1217,544 @@ func scanIntoOutput(rows *sql.Rows) (Output, error) {
 		return nil, err
 	}
 
-	return makeOutput(id, userID, outputName, listID, param1, param2, param3, createdAt, updatedAt), nil
+	fullConfig, err := openOutputConfig(id, config, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	return makeOutput(id, userID, outputName, fullConfig, createdAt, updatedAt)
+}
+
+// sealPlaintextOutputCredentials encrypts credentials that are still in the config
+// of outputs, having been saved before credentials were stored separately
+func (s *Storage) sealPlaintextOutputCredentials() error {
+	rows, err := s.db.Query(
+		"select id, output_name, config, credentials from outputs where config ?| $1",
+		pq.Array(allOutputCredentialFields()),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type plaintextOutput struct {
+		id          string
+		outputName  OutputName
+		config      []byte
+		credentials []byte
+	}
+	outputs := []plaintextOutput{}
+	for rows.Next() {
+		var o plaintextOutput
+		if err := rows.Scan(&o.id, &o.outputName, &o.config, &o.credentials); err != nil {
+			return err
+		}
+		outputs = append(outputs, o)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, o := range outputs {
+		fullConfig, err := openOutputConfig(o.id, o.config, o.credentials)
+		if err != nil {
+			return err
+		}
+		config, credentials, err := sealOutputConfig(o.id, o.outputName, fullConfig)
+		if err != nil {
+			return err
+		}
+		if credentials == nil {
+			continue
+		}
+		if _, err := s.db.Exec(
+			"update outputs set config = $1, credentials = $2 where id = $3",
+			jsonObjectOrEmpty(config),
+			credentials,
+			o.id,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const outboxJobColumns = "id, output_id, user_id, subscriber, status, attempts, max_attempts, last_error, next_attempt_at, created_at, updated_at"
+
+func (s *Storage) InsertNewOutboxJobs(jobs []*OutboxJob) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertOutboxJobs(tx, jobs); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertOutboxJobs(tx *sql.Tx, jobs []*OutboxJob) error {
+	query := `
+		insert into outbox_jobs
+		(id, output_id, user_id, subscriber, status, attempts, max_attempts, last_error, next_attempt_at, created_at, updated_at)
+		values
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	for _, job := range jobs {
+		b, err := json.Marshal(job.Subscriber)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(
+			query,
+			job.ID,
+			job.OutputID,
+			job.UserID,
+			b,
+			job.Status,
+			job.Attempts,
+			job.MaxAttempts,
+			job.LastError,
+			job.NextAttemptAt,
+			job.CreatedAt,
+			job.UpdatedAt,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ClaimDueOutboxJobs marks up to limit pending jobs whose next attempt is due as processing
+// and returns them. Jobs left in processing for longer than outboxProcessingStale
+// (e.g. because a Lambda was frozen mid-delivery) are claimed again.
+func (s *Storage) ClaimDueOutboxJobs(limit int) ([]*OutboxJob, error) {
+	now := time.Now()
+	query := fmt.Sprintf(`
+		update outbox_jobs set status = $1
+		where id in (
+			select id from outbox_jobs
+			where (status = $2 and next_attempt_at <= $3) or (status = $1 and updated_at <= $4)
+			order by next_attempt_at
+			limit $5
+			for update skip locked
+		)
+		returning %s
+	`, outboxJobColumns)
+
+	rows, err := s.db.Query(
+		query,
+		OutboxJobStatusProcessing,
+		OutboxJobStatusPending,
+		now,
+		now.Add(-outboxProcessingStale),
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanIntoOutboxJobs(rows)
+}
+
+// ClaimOutboxJobsByIDs marks the given pending jobs as processing and returns them.
+// Jobs that were already claimed elsewhere are skipped.
+func (s *Storage) ClaimOutboxJobsByIDs(ids []string) ([]*OutboxJob, error) {
+	query := fmt.Sprintf(`
+		update outbox_jobs set status = $1
+		where id in (
+			select id from outbox_jobs
+			where id = any($2) and status = $3
+			for update skip locked
+		)
+		returning %s
+	`, outboxJobColumns)
+
+	rows, err := s.db.Query(query, OutboxJobStatusProcessing, pq.Array(ids), OutboxJobStatusPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanIntoOutboxJobs(rows)
+}
+
+func (s *Storage) GetAllOutboxJobs(status OutboxJobStatus, page Page) ([]*OutboxJob, string, error) {
+	return s.queryOutboxJobPage(page, nil, nil, status)
+}
+
+func (s *Storage) GetAllOutboxJobsByUserID(userID string, status OutboxJobStatus, page Page) ([]*OutboxJob, string, error) {
+	return s.queryOutboxJobPage(page, []string{"user_id = $1"}, []any{userID}, status)
+}
+
+// queryOutboxJobPage adds the status filter to conds, unless status is empty
+func (s *Storage) queryOutboxJobPage(page Page, conds []string, args []any, status OutboxJobStatus) ([]*OutboxJob, string, error) {
+	if status != "" {
+		args = append(args, status)
+		conds = append(conds, fmt.Sprintf("status = $%d", len(args)))
+	}
+
+	query, args := page.pageQuery(fmt.Sprintf("select %s from outbox_jobs", outboxJobColumns), conds, args)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	jobs, err := scanIntoOutboxJobs(rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return pageResult(jobs, page, (*OutboxJob).pageCursor)
+}
+
+// GetActiveOutboxJobSubscriberIDs returns the IDs of the subscribers
+// with a pending or processing job for the output
+func (s *Storage) GetActiveOutboxJobSubscriberIDs(outputID string) (map[string]bool, error) {
+	query := "select subscriber->>'id' from outbox_jobs where output_id = $1 and status in ($2, $3)"
+	rows, err := s.db.Query(query, outputID, OutboxJobStatusPending, OutboxJobStatusProcessing)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriberIDs := map[string]bool{}
+	for rows.Next() {
+		var subscriberID string
+		if err := rows.Scan(&subscriberID); err != nil {
+			return nil, err
+		}
+		subscriberIDs[subscriberID] = true
+	}
+	return subscriberIDs, rows.Err()
+}
+
+func (s *Storage) GetOutboxJobByID(id string) (*OutboxJob, error) {
+	rows, err := s.db.Query(fmt.Sprintf("select %s from outbox_jobs where id = $1", outboxJobColumns), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		return scanIntoOutboxJob(rows)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return nil, outboxJobNotFound(id)
+}
+
+func (s *Storage) UpdateOutboxJobResult(job *OutboxJob) error {
+	query := `
+		update outbox_jobs
+		set status = $1, attempts = $2, last_error = $3, next_attempt_at = $4
+		where id = $5
+	`
+	_, err := s.db.Exec(query, job.Status, job.Attempts, job.LastError, job.NextAttemptAt, job.ID)
+	return err
+}
+
+// RequeueOutboxJobByID moves a job back to pending with a fresh set of attempts,
+// so that dead-lettered deliveries can be retried once the underlying problem is fixed.
+// Only dead and pending jobs are requeued, since jobs that are processing or succeeded
+// would be delivered twice, and it returns false if the job was neither.
+func (s *Storage) RequeueOutboxJobByID(id string) (bool, error) {
+	query := `
+		update outbox_jobs
+		set status = $1, attempts = 0, next_attempt_at = $2
+		where id = $3 and status in ($4, $5)
+	`
+	result, err := s.db.Exec(query, OutboxJobStatusPending, time.Now(), id, OutboxJobStatusDead, OutboxJobStatusPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func scanIntoOutboxJobs(rows *sql.Rows) ([]*OutboxJob, error) {
+	jobs := []*OutboxJob{}
+	for rows.Next() {
+		job, err := scanIntoOutboxJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func scanIntoOutboxJob(rows *sql.Rows) (*OutboxJob, error) {
+	var (
+		job        = new(OutboxJob)
+		subscriber []byte
+	)
+
+	err := rows.Scan(
+		&job.ID,
+		&job.OutputID,
+		&job.UserID,
+		&subscriber,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.LastError,
+		&job.NextAttemptAt,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(subscriber, &job.Subscriber); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+const deliveryColumns = "id, outbox_job_id, output_id, user_id, subscriber_id, success, status_code, error, latency_ms, created_at"
+
+func (s *Storage) InsertNewDelivery(delivery *Delivery) error {
+	query := `
+		insert into deliveries
+		(id, outbox_job_id, output_id, user_id, subscriber_id, success, status_code, error, latency_ms, created_at)
+		values
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err := s.db.Exec(
+		query,
+		delivery.ID,
+		delivery.OutboxJobID,
+		delivery.OutputID,
+		delivery.UserID,
+		delivery.SubscriberID,
+		delivery.Success,
+		delivery.StatusCode,
+		delivery.Error,
+		delivery.LatencyMs,
+		delivery.CreatedAt,
+	)
+	return err
+}
+
+func (s *Storage) GetAllDeliveriesByOutputID(outputID string, page Page) ([]*Delivery, string, error) {
+	query, args := page.pageQuery(fmt.Sprintf("select %s from deliveries", deliveryColumns), []string{"output_id = $1"}, []any{outputID})
+	return s.queryDeliveryPage(page, query, args...)
+}
+
+func (s *Storage) GetAllDeliveriesByOutputIDAndUserID(outputID string, userID string, page Page) ([]*Delivery, string, error) {
+	query, args := page.pageQuery(fmt.Sprintf("select %s from deliveries", deliveryColumns), []string{"output_id = $1", "user_id = $2"}, []any{outputID, userID})
+	return s.queryDeliveryPage(page, query, args...)
+}
+
+func (s *Storage) GetAllDeliveriesBySubscriberID(subscriberID string, page Page) ([]*Delivery, string, error) {
+	query, args := page.pageQuery(fmt.Sprintf("select %s from deliveries", deliveryColumns), []string{"subscriber_id = $1"}, []any{subscriberID})
+	return s.queryDeliveryPage(page, query, args...)
+}
+
+func (s *Storage) GetAllDeliveriesBySubscriberIDAndUserID(subscriberID string, userID string, page Page) ([]*Delivery, string, error) {
+	query, args := page.pageQuery(fmt.Sprintf("select %s from deliveries", deliveryColumns), []string{"subscriber_id = $1", "user_id = $2"}, []any{subscriberID, userID})
+	return s.queryDeliveryPage(page, query, args...)
+}
+
+func (s *Storage) queryDeliveryPage(page Page, query string, args ...any) ([]*Delivery, string, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	deliveries := []*Delivery{}
+	for rows.Next() {
+		delivery, err := scanIntoDelivery(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	return pageResult(deliveries, page, (*Delivery).pageCursor)
+}
+
+func scanIntoDelivery(rows *sql.Rows) (*Delivery, error) {
+	delivery := new(Delivery)
+	err := rows.Scan(
+		&delivery.ID,
+		&delivery.OutboxJobID,
+		&delivery.OutputID,
+		&delivery.UserID,
+		&delivery.SubscriberID,
+		&delivery.Success,
+		&delivery.StatusCode,
+		&delivery.Error,
+		&delivery.LatencyMs,
+		&delivery.CreatedAt,
+	)
+	return delivery, err
+}
+
+// InsertNewOAuthState saves the campaign context for a visit that is about to be
+// sent to an OAuth provider, clearing out any states that have expired unused.
+func (s *Storage) InsertNewOAuthState(st *OAuthState) error {
+	if _, err := s.db.Exec("delete from oauth_states where created_at < $1", time.Now().Add(-oauthStateMaxAge)); err != nil {
+		return err
+	}
+
+	query := `
+		insert into oauth_states
+		(state, email_list_id, provider_name, output_ids, redirect_url, created_at, code_verifier)
+		values
+		($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := s.db.Exec(
+		query,
+		st.State,
+		st.EmailListID,
+		st.ProviderName,
+		pq.Array(st.OutputIDs),
+		st.RedirectUrl,
+		st.CreatedAt,
+		st.CodeVerifier,
+	)
+	return err
+}
+
+// ConsumeOAuthState deletes and returns the state if it was created after notBefore.
+// Deleting it means the same state can never be used twice.
+func (s *Storage) ConsumeOAuthState(state string, notBefore time.Time) (*OAuthState, error) {
+	query := `
+		delete from oauth_states
+		where state = $1 and created_at >= $2
+		returning state, email_list_id, provider_name, output_ids, redirect_url, created_at, code_verifier
+	`
+	rows, err := s.db.Query(query, state, notBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		st := new(OAuthState)
+		err := rows.Scan(
+			&st.State,
+			&st.EmailListID,
+			&st.ProviderName,
+			pq.Array(&st.OutputIDs),
+			&st.RedirectUrl,
+			&st.CreatedAt,
+			&st.CodeVerifier,
+		)
+		return st, err
+	}
+	return nil, invalidOAuthState()
+}
+
+const providerFailureColumns = "id, email_list_id, user_id, provider_name, stage, status_code, error, created_at"
+
+func (s *Storage) InsertNewProviderFailure(failure *ProviderFailure) error {
+	query := `
+		insert into provider_failures
+		(id, email_list_id, user_id, provider_name, stage, status_code, error, created_at)
+		values
+		($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := s.db.Exec(
+		query,
+		failure.ID,
+		failure.EmailListID,
+		failure.UserID,
+		failure.ProviderName,
+		failure.Stage,
+		failure.StatusCode,
+		failure.Error,
+		failure.CreatedAt,
+	)
+	return err
+}
+
+func (s *Storage) GetAllProviderFailuresByEmailListID(emailListID string, page Page) ([]*ProviderFailure, string, error) {
+	query, args := page.pageQuery(fmt.Sprintf("select %s from provider_failures", providerFailureColumns), []string{"email_list_id = $1"}, []any{emailListID})
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	failures := []*ProviderFailure{}
+	for rows.Next() {
+		failure := new(ProviderFailure)
+		if err := rows.Scan(
+			&failure.ID,
+			&failure.EmailListID,
+			&failure.UserID,
+			&failure.ProviderName,
+			&failure.Stage,
+			&failure.StatusCode,
+			&failure.Error,
+			&failure.CreatedAt,
+		); err != nil {
+			return nil, "", err
+		}
+		failures = append(failures, failure)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	return pageResult(failures, page, (*ProviderFailure).pageCursor)
+}
+
+const subscriberJoinColumns = "id, subscriber_id, email_list_id, user_id, provider_name, rejoin, created_at"
+
+func (s *Storage) GetAllSubscriberJoinsBySubscriberID(subscriberID string, page Page) ([]*SubscriberJoin, string, error) {
+	query, args := page.pageQuery(fmt.Sprintf("select %s from subscriber_joins", subscriberJoinColumns), []string{"subscriber_id = $1"}, []any{subscriberID})
+	return s.querySubscriberJoinPage(page, query, args...)
+}
+
+func (s *Storage) GetAllSubscriberJoinsBySubscriberIDAndUserID(subscriberID string, userID string, page Page) ([]*SubscriberJoin, string, error) {
+	query, args := page.pageQuery(fmt.Sprintf("select %s from subscriber_joins", subscriberJoinColumns), []string{"subscriber_id = $1", "user_id = $2"}, []any{subscriberID, userID})
+	return s.querySubscriberJoinPage(page, query, args...)
+}
+
+func (s *Storage) querySubscriberJoinPage(page Page, query string, args ...any) ([]*SubscriberJoin, string, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	joins := []*SubscriberJoin{}
+	for rows.Next() {
+		join := new(SubscriberJoin)
+		if err := rows.Scan(
+			&join.ID,
+			&join.SubscriberID,
+			&join.EmailListID,
+			&join.UserID,
+			&join.ProviderName,
+			&join.Rejoin,
+			&join.CreatedAt,
+		); err != nil {
+			return nil, "", err
+		}
+		joins = append(joins, join)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	return pageResult(joins, page, (*SubscriberJoin).pageCursor)
 }
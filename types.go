@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"os"
@@ -32,12 +33,21 @@ func (c Campaign) Link() (string, error) {
 	return fmt.Sprintf("%s//%s/c?c=%s", protocol, hostname, url.QueryEscape(oauthID)), nil
 }
 
-type DiscordOAuth2TokenResp struct {
-	TokenType    string `json:"token_type"`
-	AccessToken  string `json:"access_token"`
-	ExpiresIn    int    `json:"expires_in"`
-	RefreshToken string `json:"refresh_token"`
-	Scope        string `json:"scope"`
+type ConvertKitSubscribeReq struct {
+	ApiKey    string `json:"api_key"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+}
+
+// DiscordAllowedMentions stops a subscriber's name from pinging a role or @everyone
+type DiscordAllowedMentions struct {
+	Parse []string `json:"parse"`
+}
+
+type DiscordMessageReq struct {
+	Content         string                 `json:"content,omitempty"`
+	Embeds          json.RawMessage        `json:"embeds,omitempty"`
+	AllowedMentions DiscordAllowedMentions `json:"allowed_mentions"`
 }
 
 type DiscordProviderResp struct {
@@ -60,32 +70,117 @@ type DiscordProviderResp struct {
 	Verified             bool    `json:"verified"`
 }
 
+type Delivery struct {
+	ID           string    `json:"id"`
+	OutboxJobID  string    `json:"outboxJobId"`
+	OutputID     string    `json:"outputId"`
+	UserID       string    `json:"userId"`
+	SubscriberID string    `json:"subscriberId"`
+	Success      bool      `json:"success"`
+	StatusCode   int       `json:"statusCode"`
+	Error        string    `json:"error"`
+	LatencyMs    int64     `json:"latencyMs"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func NewDelivery(outboxJobID string, outputID string, userID string, subscriberID string, statusCode int, latency time.Duration, err error) *Delivery {
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+	}
+	if statusCode == 0 {
+		statusCode = statusCodeOf(err)
+	}
+	return &Delivery{
+		ID:           NewUUID(),
+		OutboxJobID:  outboxJobID,
+		OutputID:     outputID,
+		UserID:       userID,
+		SubscriberID: subscriberID,
+		Success:      err == nil,
+		StatusCode:   statusCode,
+		Error:        errMsg,
+		LatencyMs:    latency.Milliseconds(),
+		CreatedAt:    time.Now(),
+	}
+}
+
 type EmailList struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"userId"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID                    string                `json:"id"`
+	UserID                string                `json:"userId"`
+	Name                  string                `json:"name"`
+	UnverifiedEmailPolicy UnverifiedEmailPolicy `json:"unverifiedEmailPolicy"`
+	CreatedAt             time.Time             `json:"createdAt"`
+	UpdatedAt             time.Time             `json:"updatedAt"`
 }
 
-func NewEmailList(userID string, name string) *EmailList {
+func NewEmailList(userID string, name string, unverifiedEmailPolicy UnverifiedEmailPolicy) *EmailList {
+	if unverifiedEmailPolicy == "" {
+		unverifiedEmailPolicy = UnverifiedEmailPolicyAccept
+	}
 	now := time.Now()
 	return &EmailList{
-		ID:        NewUUID(),
-		UserID:    userID,
-		Name:      name,
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:                    NewUUID(),
+		UserID:                userID,
+		Name:                  name,
+		UnverifiedEmailPolicy: unverifiedEmailPolicy,
+		CreatedAt:             now,
+		UpdatedAt:             now,
 	}
 }
 
 type EmailListCreationReq struct {
-	UserID string `json:"userId"`
-	Name   string `json:"name"`
+	UserID                string                `json:"userId"`
+	Name                  string                `json:"name"`
+	UnverifiedEmailPolicy UnverifiedEmailPolicy `json:"unverifiedEmailPolicy"`
 }
 
+// EmailListDeleteMode decides what happens to the subscribers of an email list that is deleted
+type EmailListDeleteMode string
+
+const (
+	// EmailListDeleteModeArchive detaches the subscribers from the list and marks them archived
+	EmailListDeleteModeArchive EmailListDeleteMode = "archive"
+	// EmailListDeleteModeCascade deletes the subscribers along with the list
+	EmailListDeleteModeCascade EmailListDeleteMode = "cascade"
+)
+
 type EmailListUpdateReq struct {
-	Name string `json:"name"`
+	Name                  string                `json:"name"`
+	UnverifiedEmailPolicy UnverifiedEmailPolicy `json:"unverifiedEmailPolicy"`
+}
+
+// GenericProviderConfig describes an OAuth2 or OpenID Connect provider that is
+// configured at runtime rather than hand-written. If Issuer is set, any endpoint
+// left empty is resolved via OIDC discovery.
+type GenericProviderConfig struct {
+	Name         ProviderName `json:"name"`
+	ClientID     string       `json:"clientId"`
+	ClientSecret string       `json:"clientSecret"`
+	Issuer       string       `json:"issuer"`
+	AuthURL      string       `json:"authUrl"`
+	TokenURL     string       `json:"tokenUrl"`
+	UserInfoURL  string       `json:"userInfoUrl"`
+	Scopes       []string     `json:"scopes"`
+	EmailPath    string       `json:"emailPath"`
+	NamePath     string       `json:"namePath"`
+	// Path to a boolean claim saying whether the provider has verified the email address
+	EmailVerifiedPath string `json:"emailVerifiedPath"`
+}
+
+type GitHubEmailResp struct {
+	Email      string  `json:"email"`
+	Primary    bool    `json:"primary"`
+	Verified   bool    `json:"verified"`
+	Visibility *string `json:"visibility"`
+}
+
+type GitHubProviderResp struct {
+	ID        int64   `json:"id"`
+	Login     string  `json:"login"`
+	Name      *string `json:"name"`
+	Email     *string `json:"email"`
+	AvatarURL string  `json:"avatar_url"`
 }
 
 type GoogleProviderResp struct {
@@ -96,6 +191,42 @@ type GoogleProviderResp struct {
 	GivenName     string `json:"given_name"`
 	FamilyName    string `json:"family_name"`
 	Picture       string `json:"picture"`
+	Locale        string `json:"locale"`
+}
+
+// ImportInvalidRow is a row of an import file that could not be turned into a subscriber
+type ImportInvalidRow struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type ImportResult struct {
+	Inserted int `json:"inserted"`
+	// Rows whose email address was already on the list, or earlier in the file
+	Skipped int                `json:"skipped"`
+	Invalid []ImportInvalidRow `json:"invalid"`
+	// Deliveries added to the outbox for the inserted subscribers
+	Queued int `json:"queued"`
+}
+
+// JSONSchema is the subset of JSON Schema used to describe and validate output configs
+type JSONSchema struct {
+	Type        string                 `json:"type,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Properties  map[string]*JSONSchema `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+	// Either false, or the schema of every property not in Properties
+	AdditionalProperties any `json:"additionalProperties,omitempty"`
+	// Write-only properties are credentials, which are stored encrypted and never returned
+	WriteOnly bool `json:"writeOnly,omitempty"`
+	// The value must also be valid against at least one of these schemas
+	AnyOf     []*JSONSchema `json:"anyOf,omitempty"`
+	Items     *JSONSchema   `json:"items,omitempty"`
+	MaxItems  int           `json:"maxItems,omitempty"`
+	Enum      []string      `json:"enum,omitempty"`
+	MinLength int           `json:"minLength,omitempty"`
+	MaxLength int           `json:"maxLength,omitempty"`
+	Pattern   string        `json:"pattern,omitempty"`
 }
 
 type LoginInfo struct {
@@ -103,87 +234,374 @@ type LoginInfo struct {
 	Password string `json:"password"`
 }
 
+type MailchimpMemberReq struct {
+	EmailAddress string                `json:"email_address"`
+	StatusIfNew  MailchimpMemberStatus `json:"status_if_new"`
+	MergeFields  map[string]string     `json:"merge_fields"`
+}
+
+type MailchimpTag struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+type MailchimpTagsReq struct {
+	Tags []MailchimpTag `json:"tags"`
+}
+
+type MailerLiteSubscriberReq struct {
+	Email  string            `json:"email"`
+	Fields map[string]string `json:"fields"`
+	Groups []string          `json:"groups"`
+}
+
+type MicrosoftProviderResp struct {
+	ID                string  `json:"id"`
+	DisplayName       string  `json:"displayName"`
+	GivenName         *string `json:"givenName"`
+	Surname           *string `json:"surname"`
+	Mail              *string `json:"mail"`
+	UserPrincipalName string  `json:"userPrincipalName"`
+	PreferredLanguage *string `json:"preferredLanguage"`
+}
+
+type OIDCDiscoveryDoc struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// OutputApiErrorResp has the fields that third-party APIs use to explain an error response
+type OutputApiErrorResp struct {
+	Detail  string `json:"detail"`
+	Message string `json:"message"`
+	Error   string `json:"error"`
+	Title   string `json:"title"`
+}
+
+type OutboxJob struct {
+	ID            string          `json:"id"`
+	OutputID      string          `json:"outputId"`
+	UserID        string          `json:"userId"`
+	Subscriber    Subscriber      `json:"subscriber"`
+	Status        OutboxJobStatus `json:"status"`
+	Attempts      int             `json:"attempts"`
+	MaxAttempts   int             `json:"maxAttempts"`
+	LastError     string          `json:"lastError"`
+	NextAttemptAt time.Time       `json:"nextAttemptAt"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	UpdatedAt     time.Time       `json:"updatedAt"`
+}
+
+func NewOutboxJob(outputID string, userID string, subscriber Subscriber) *OutboxJob {
+	now := time.Now()
+	return &OutboxJob{
+		ID:            NewUUID(),
+		OutputID:      outputID,
+		UserID:        userID,
+		Subscriber:    subscriber,
+		Status:        OutboxJobStatusPending,
+		Attempts:      0,
+		MaxAttempts:   outboxMaxAttempts,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
 type Output interface {
 	OutputName() OutputName
+	GetID() string
 	GetUserID() string
-	Handle(emailAddr string, name string) error
+	GetCreatedAt() time.Time
+	GetUpdatedAt() time.Time
+	// Handle sends the subscriber to the output, and returns the status code of the
+	// last response from the output's API, which is 0 if no request was made
+	Handle(subscriber Subscriber) (int, error)
 }
 
 type OutputsData map[OutputName][]Output
 
+// OutputCreationReq creates an output. Config must match the schema
+// for the output name, see GET /outputs/schemas.
 type OutputCreationReq struct {
-	UserID     string     `json:"userId"`
-	OutputName OutputName `json:"outputName"`
-	ListID     string     `json:"listId"`
-	Param1     string     `json:"param1"`
-	Param2     string     `json:"param2"`
-	Param3     string     `json:"param3"`
+	UserID     string          `json:"userId"`
+	OutputName OutputName      `json:"outputName"`
+	Config     json.RawMessage `json:"config"`
 }
 
+// OutputUpdateReq updates an output. Config is merged into the current config,
+// unless the output name changes, in which case it replaces it.
 type OutputUpdateReq struct {
-	OutputName OutputName `json:"outputName"`
-	ListID     string     `json:"listId"`
-	Param1     string     `json:"param1"`
-	Param2     string     `json:"param2"`
-	Param3     string     `json:"param3"`
+	OutputName OutputName      `json:"outputName"`
+	Config     json.RawMessage `json:"config"`
+}
+
+type OutputReplayReq struct {
+	EmailListID   string     `json:"emailListId"`
+	CreatedAfter  *time.Time `json:"createdAfter"`
+	CreatedBefore *time.Time `json:"createdBefore"`
+}
+
+// OutputReplayResult is what a replay did with one subscriber. The progress of a queued
+// subscriber can be followed through its outbox job and the output's deliveries.
+type OutputReplayResult struct {
+	SubscriberID string             `json:"subscriberId"`
+	EmailAddr    string             `json:"emailAddr"`
+	JobID        string             `json:"jobId,omitempty"`
+	Status       OutputReplayStatus `json:"status"`
+	Reason       string             `json:"reason,omitempty"`
+	Error        string             `json:"error,omitempty"`
+}
+
+// The config of each output is embedded in it, so that the
+// config fields sit alongside the ID when the output is returned
+
+type AWeberOutputConfig struct {
+	ListID     string `json:"listId"`
+	AdTracking string `json:"adTracking,omitempty"`
 }
 
 type AWeberOutput struct {
-	ID         string    `json:"id"`
-	UserID     string    `json:"userId"`
-	ListID     string    `json:"listId"`
-	AdTracking string    `json:"adTracking"`
-	CreatedAt  time.Time `json:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt"`
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	AWeberOutputConfig
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type BrevoOutputConfig struct {
+	ListID string `json:"listId"`
+	// Falls back to the BREVO_API_KEY env var when empty
+	ApiKey string `json:"apiKey,omitempty"`
 }
 
 type BrevoOutput struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"userId"`
-	ListID    string    `json:"listId"`
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	BrevoOutputConfig
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+type ConvertKitOutputConfig struct {
+	ApiKey string `json:"apiKey"`
+	FormID string `json:"formId,omitempty"`
+	TagID  string `json:"tagId,omitempty"`
+}
+
+type ConvertKitOutput struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	ConvertKitOutputConfig
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type DiscordOutputConfig struct {
+	WebhookUrl string `json:"webhookUrl"`
+	MsgFmt     string `json:"msgFmt,omitempty"`
+	// Discord embed objects, whose strings can use the same template variables as MsgFmt
+	Embeds json.RawMessage `json:"embeds,omitempty"`
+}
+
+type DiscordOutput struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	DiscordOutputConfig
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type MailchimpOutputConfig struct {
+	AudienceID string `json:"audienceId"`
+	// Pending members are sent a confirmation email (double opt-in) before they are subscribed
+	Status MailchimpMemberStatus `json:"status,omitempty"`
+	Tags   []string              `json:"tags,omitempty"`
+	// Falls back to the MAILCHIMP_API_KEY env var when empty
+	ApiKey string `json:"apiKey,omitempty"`
+}
+
+type MailchimpOutput struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	MailchimpOutputConfig
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type MailerLiteOutputConfig struct {
+	ApiKey  string `json:"apiKey"`
+	GroupID string `json:"groupId"`
+}
+
+type MailerLiteOutput struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	MailerLiteOutputConfig
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type ResendOutputConfig struct {
+	AudienceID string `json:"audienceId"`
+	// Falls back to the RESEND_API_KEY env var when empty
+	ApiKey string `json:"apiKey,omitempty"`
+}
+
 type ResendOutput struct {
-	ID         string    `json:"id"`
-	UserID     string    `json:"userId"`
-	AudienceID string    `json:"audienceId"`
-	CreatedAt  time.Time `json:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt"`
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	ResendOutputConfig
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type SlackOutputConfig struct {
+	WebhookUrl string `json:"webhookUrl"`
+	// Slack shows the message in notifications even when there are blocks
+	MsgFmt string `json:"msgFmt,omitempty"`
+	// Slack Block Kit blocks, whose strings can use the same template variables as MsgFmt
+	Blocks json.RawMessage `json:"blocks,omitempty"`
+}
+
+type SlackOutput struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	SlackOutputConfig
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type TelegramOutputConfig struct {
+	ChatID string `json:"chatId"`
+	MsgFmt string `json:"msgFmt"`
+	// Falls back to the TELEGRAM_BOT_ID env var when empty
+	BotID string `json:"botId,omitempty"`
 }
 
 type TelegramOutput struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"userId"`
-	ChatID    string    `json:"chatId"`
-	MsgFmt    string    `json:"msgFmt"`
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	TelegramOutputConfig
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+type WebhookOutputConfig struct {
+	UrlFmt string `json:"urlFmt"`
+	// Requests other than GET carry a WebhookEvent as their body
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Signs each request when set, see signWebhook
+	Secret string `json:"secret,omitempty"`
+}
+
 type WebhookOutput struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"userId"`
-	UrlFmt    string    `json:"urlFmt"`
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	WebhookOutputConfig
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+// WebhookEvent is the JSON body sent by webhook outputs
+type WebhookEvent struct {
+	Type       WebhookEventType `json:"type"`
+	Timestamp  time.Time        `json:"timestamp"`
+	Provider   ProviderName     `json:"provider"`
+	Subscriber Subscriber       `json:"subscriber"`
+	// Nil if the subscriber is no longer on an email list
+	EmailList *EmailList `json:"emailList"`
+}
+
+// Page is a keyset pagination request for a list endpoint, see ParsePage
+type Page struct {
+	Limit  int
+	Sort   string
+	Cursor *PageCursor
+	key    string
+	desc   bool
+	column pageSortColumn
+}
+
+// PageCursor points just past the last row of a page, by the value
+// of its sort column and its ID to break ties.
+type PageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+type ProviderFailure struct {
+	ID           string             `json:"id"`
+	EmailListID  string             `json:"emailListId"`
+	UserID       string             `json:"userId"`
+	ProviderName ProviderName       `json:"providerName"`
+	Stage        ProviderErrorStage `json:"stage"`
+	StatusCode   int                `json:"statusCode"`
+	Error        string             `json:"error"`
+	CreatedAt    time.Time          `json:"createdAt"`
+}
+
+func NewProviderFailure(emailListID string, userID string, providerName ProviderName, err error) *ProviderFailure {
+	return &ProviderFailure{
+		ID:           NewUUID(),
+		EmailListID:  emailListID,
+		UserID:       userID,
+		ProviderName: providerName,
+		Stage:        providerErrorStageOf(err),
+		StatusCode:   statusCodeOf(err),
+		Error:        err.Error(),
+		CreatedAt:    time.Now(),
+	}
+}
+
 type ProviderResult struct {
-	Name      string `json:"name"`
-	EmailAddr string `json:"emailAddr"`
+	Name              string          `json:"name"`
+	EmailAddr         string          `json:"emailAddr"`
+	EmailVerified     bool            `json:"emailVerified"`
+	ProviderSubjectID string          `json:"providerSubjectId"`
+	GivenName         string          `json:"givenName"`
+	FamilyName        string          `json:"familyName"`
+	AvatarURL         string          `json:"avatarUrl"`
+	Locale            string          `json:"locale"`
+	RawProfile        json.RawMessage `json:"rawProfile"`
+}
+
+type RedditProviderResp struct {
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	IconImg          string `json:"icon_img"`
+	HasVerifiedEmail bool   `json:"has_verified_email"`
+}
+
+type SlackMessageReq struct {
+	Text   string          `json:"text,omitempty"`
+	Blocks json.RawMessage `json:"blocks,omitempty"`
 }
 
 type Subscriber struct {
-	ID                 string       `json:"id"`
-	EmailListID        string       `json:"emailListId"`
-	UserID             string       `json:"userId"`
-	SourceProviderName ProviderName `json:"sourceProviderName"`
-	Name               string       `json:"name"`
-	EmailAddr          string       `json:"emailAddr"`
-	CreatedAt          time.Time    `json:"createdAt"`
-	UpdatedAt          time.Time    `json:"updatedAt"`
+	ID                 string          `json:"id"`
+	EmailListID        string          `json:"emailListId"`
+	UserID             string          `json:"userId"`
+	SourceProviderName ProviderName    `json:"sourceProviderName"`
+	Name               string          `json:"name"`
+	EmailAddr          string          `json:"emailAddr"`
+	EmailVerified      bool            `json:"emailVerified"`
+	Tags               []string        `json:"tags"`
+	ProviderSubjectID  string          `json:"providerSubjectId"`
+	GivenName          string          `json:"givenName"`
+	FamilyName         string          `json:"familyName"`
+	AvatarURL          string          `json:"avatarUrl"`
+	Locale             string          `json:"locale"`
+	RawProfile         json.RawMessage `json:"rawProfile"`
+	// Set when the subscriber's email list was deleted with EmailListDeleteModeArchive
+	ArchivedAt          *time.Time `json:"archivedAt"`
+	ArchivedEmailListID string     `json:"archivedEmailListId"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
 }
 
 func NewSubscriber(
@@ -201,22 +619,86 @@ func NewSubscriber(
 		SourceProviderName: sourceProviderName,
 		Name:               name,
 		EmailAddr:          emailAddr,
+		Tags:               []string{},
 		CreatedAt:          now,
 		UpdatedAt:          now,
 	}
 }
 
+// FirstAndLastName returns the subscriber's given and family names, falling back
+// to the full name as the first name when the provider did not split it up.
+func (s Subscriber) FirstAndLastName() (string, string) {
+	if s.GivenName == "" && s.FamilyName == "" {
+		return s.Name, ""
+	}
+	return s.GivenName, s.FamilyName
+}
+
 type SubscriberCreationReq struct {
 	EmailListID        string       `json:"emailListId"`
 	UserID             string       `json:"userId"`
 	SourceProviderName ProviderName `json:"sourceProviderName"`
 	Name               string       `json:"name"`
 	EmailAddr          string       `json:"emailAddr"`
+	EmailVerified      bool         `json:"emailVerified"`
+	Tags               []string     `json:"tags"`
+	GivenName          string       `json:"givenName"`
+	FamilyName         string       `json:"familyName"`
+}
+
+// SubscriberJoin records a visitor signing up to an email list through a campaign.
+// Rejoin is set when they were already subscribed to the list.
+type SubscriberJoin struct {
+	ID           string       `json:"id"`
+	SubscriberID string       `json:"subscriberId"`
+	EmailListID  string       `json:"emailListId"`
+	UserID       string       `json:"userId"`
+	ProviderName ProviderName `json:"providerName"`
+	Rejoin       bool         `json:"rejoin"`
+	CreatedAt    time.Time    `json:"createdAt"`
+}
+
+func NewSubscriberJoin(subscriber Subscriber, providerName ProviderName, rejoin bool) *SubscriberJoin {
+	return &SubscriberJoin{
+		ID:           NewUUID(),
+		SubscriberID: subscriber.ID,
+		EmailListID:  subscriber.EmailListID,
+		UserID:       subscriber.UserID,
+		ProviderName: providerName,
+		Rejoin:       rejoin,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// SubscriberFilter narrows down a subscriber search. Empty fields are not filtered on.
+type SubscriberFilter struct {
+	UserID             string
+	EmailListID        string
+	SourceProviderName ProviderName
+	CreatedAfter       *time.Time
+	CreatedBefore      *time.Time
+	// Case-insensitive substring of the email address or name
+	Q string
 }
 
 type SubscriberUpdateReq struct {
-	Name      string `json:"name"`
-	EmailAddr string `json:"emailAddr"`
+	Name       string   `json:"name"`
+	EmailAddr  string   `json:"emailAddr"`
+	GivenName  string   `json:"givenName"`
+	FamilyName string   `json:"familyName"`
+	Tags       []string `json:"tags"`
+}
+
+type TwitchProviderResp struct {
+	Data []TwitchUser `json:"data"`
+}
+
+type TwitchUser struct {
+	ID              string `json:"id"`
+	Login           string `json:"login"`
+	DisplayName     string `json:"display_name"`
+	Email           string `json:"email"`
+	ProfileImageURL string `json:"profile_image_url"`
 }
 
 type User struct {
@@ -239,40 +721,57 @@ type UserUpdateReq struct {
 
 const (
 	ContentTypeApplicationJson               string = "application/json"
+	ContentTypeApplicationXNdjson            string = "application/x-ndjson"
 	ContentTypeApplicationXwwwFormUrlEncoded string = "application/x-www-form-urlencoded"
+	ContentTypeTextCsv                       string = "text/csv"
 )
 
 type CookieName string
 
+const CookieNameJWT CookieName = "jwt"
+
+// FileFormat is the file format of an email list export or import
+type FileFormat string
+
 const (
-	CookieNameCreatedAt    CookieName = "createdAt"
-	CookieNameEmailListID  CookieName = "emailListId"
-	CookieNameJWT          CookieName = "jwt"
-	CookieNameOutputIDs    CookieName = "outputIds"
-	CookieNameProviderName CookieName = "providerName"
-	CookieNameRedirectURL  CookieName = "redirectUrl"
+	FileFormatCSV   FileFormat = "csv"
+	FileFormatJSONL FileFormat = "jsonl"
 )
 
+func validFileFormat(format FileFormat) bool {
+	return format == FileFormatCSV || format == FileFormatJSONL
+}
+
 const (
 	EnvBrevoApiKey           string = "BREVO_API_KEY"
 	EnvCatchAllRedirectUrl   string = "CATCH_ALL_REDIRECT_URL"
-	EnvCookieSecret          string = "COOKIE_SECRET"
 	EnvCryptoSecret          string = "CRYPTO_SECRET"
 	EnvDiscordClientID       string = "DISCORD_CLIENT_ID"
 	EnvDiscordClientSecret   string = "DISCORD_CLIENT_SECRET"
+	EnvGitHubClientID        string = "GITHUB_CLIENT_ID"
+	EnvGitHubClientSecret    string = "GITHUB_CLIENT_SECRET"
 	EnvGoogleClientID        string = "GOOGLE_CLIENT_ID"
 	EnvGoogleClientSecret    string = "GOOGLE_CLIENT_SECRET"
-	EnvGoogleOAuthStateStr   string = "GOOGLE_OAUTH_STATE_STR"
 	EnvHostname              string = "HOST_NAME"
 	EnvJWTSecret             string = "JWT_SECRET"
+	EnvMailchimpApiKey       string = "MAILCHIMP_API_KEY"
+	EnvMicrosoftClientID     string = "MICROSOFT_CLIENT_ID"
+	EnvMicrosoftClientSecret string = "MICROSOFT_CLIENT_SECRET"
+	EnvMicrosoftTenant       string = "MICROSOFT_TENANT"
+	EnvOAuthProviders        string = "OAUTH_PROVIDERS"
+	EnvOAuthProvidersFile    string = "OAUTH_PROVIDERS_FILE"
 	EnvPort                  string = "PORT"
 	EnvProtocol              string = "PROTOCOL"
 	EnvPostgresConnStr       string = "POSTGRES_CONN_STR"
+	EnvRedditClientID        string = "REDDIT_CLIENT_ID"
+	EnvRedditClientSecret    string = "REDDIT_CLIENT_SECRET"
 	EnvResendApiKey          string = "RESEND_API_KEY"
 	EnvRootPassword          string = "ROOT_PASSWORD"
 	EnvRootUsername          string = "ROOT_USERNAME"
 	EnvRunningFromServerless string = "RUNNING_FROM_SERVERLESS"
 	EnvTelegramBotID         string = "TELEGRAM_BOT_ID"
+	EnvTwitchClientID        string = "TWITCH_CLIENT_ID"
+	EnvTwitchClientSecret    string = "TWITCH_CLIENT_SECRET"
 )
 
 const (
@@ -280,26 +779,70 @@ const (
 	FormFieldClientID       string = "client_id"
 	FormFieldClientSecret   string = "client_secret"
 	FormFieldCode           string = "code"
+	FormFieldCodeVerifier   string = "code_verifier"
 	FormFieldEmail          string = "email"
-	FormFieldGrantType      string = "grant_type"
 	FormFieldListName       string = "listname"
 	FormFieldName           string = "name"
-	FormFieldRedirectUri    string = "redirect_uri"
 	FormFieldText           string = "text"
 	FormFieldTelegramChatID string = "chat_id"
 )
 
-const FormValueAuthorizationCode string = "authorization_code"
+const (
+	DiscordOauthScopeEmail    string = "email"
+	DiscordOauthScopeIdentify string = "identify"
+)
+
+const (
+	GitHubOauthScopeReadUser  string = "read:user"
+	GitHubOauthScopeUserEmail string = "user:email"
+)
 
 const (
 	GoogleOauthScopeEmail   string = "email"
 	GoogleOauthScopeProfile string = "profile"
 )
 
+const MicrosoftOauthScopeUserRead string = "User.Read"
+
+const (
+	MicrosoftClaimEmailDomainOwnerVerified string = "xms_edov"
+	MicrosoftClaimTenantID                 string = "tid"
+)
+
+// The tenant that every personal Microsoft account belongs to
+const MicrosoftConsumersTenantID string = "9188040d-6c67-4c5b-b112-36a304b66dad"
+
+const OIDCTokenExtraIDToken string = "id_token"
+
+const RedditOauthScopeIdentity string = "identity"
+
+const TwitchOauthScopeUserReadEmail string = "user:read:email"
+
+const (
+	OIDCClaimFamilyName string = "family_name"
+	OIDCClaimGivenName  string = "given_name"
+	OIDCClaimLocale     string = "locale"
+	OIDCClaimPicture    string = "picture"
+	OIDCClaimSub        string = "sub"
+)
+
 const (
-	HTTPHeaderAcceptEncoding string = "Accept-Encoding"
-	HTTPHeaderAuthorization  string = "Authorization"
-	HTTPHeaderContentType    string = "Content-Type"
+	OIDCScopeEmail   string = "email"
+	OIDCScopeOpenID  string = "openid"
+	OIDCScopeProfile string = "profile"
+)
+
+const (
+	HTTPHeaderAccept             string = "Accept"
+	HTTPHeaderAcceptEncoding     string = "Accept-Encoding"
+	HTTPHeaderAuthorization      string = "Authorization"
+	HTTPHeaderClientID           string = "Client-Id"
+	HTTPHeaderContentDisposition string = "Content-Disposition"
+	HTTPHeaderContentType        string = "Content-Type"
+	HTTPHeaderNextCursor         string = "X-Next-Cursor"
+	HTTPHeaderUserAgent          string = "User-Agent"
+	HTTPHeaderWebhookSignature   string = "X-Webhook-Signature"
+	HTTPHeaderWebhookTimestamp   string = "X-Webhook-Timestamp"
 )
 
 const (
@@ -309,38 +852,114 @@ const (
 )
 
 const (
-	MuxVarUserID   string = "userID"
-	MuxVarOutputID string = "outputID"
+	MuxVarEmailListID  string = "emailListID"
+	MuxVarJobID        string = "jobID"
+	MuxVarUserID       string = "userID"
+	MuxVarOutputID     string = "outputID"
+	MuxVarProviderSlug string = "providerSlug"
+	MuxVarSubscriberID string = "subscriberID"
 )
 
 const JwtHeaderAlg string = "alg"
 
+type MailchimpMemberStatus string
+
+const (
+	MailchimpMemberStatusPending    MailchimpMemberStatus = "pending"
+	MailchimpMemberStatusSubscribed MailchimpMemberStatus = "subscribed"
+)
+
+type OutputReplayStatus string
+
+const (
+	OutputReplayStatusQueued  OutputReplayStatus = "queued"
+	OutputReplayStatusSkipped OutputReplayStatus = "skipped"
+	OutputReplayStatusError   OutputReplayStatus = "error"
+)
+
+type OutboxJobStatus string
+
+const (
+	OutboxJobStatusPending    OutboxJobStatus = "pending"
+	OutboxJobStatusProcessing OutboxJobStatus = "processing"
+	OutboxJobStatusSucceeded  OutboxJobStatus = "succeeded"
+	OutboxJobStatusDead       OutboxJobStatus = "dead"
+)
+
 type OutputName string
 
 const (
-	OutputNameAWeber   OutputName = "aweber"
-	OutputNameBrevo    OutputName = "brevo"
-	OutputNameResend   OutputName = "resend"
-	OutputNameTelegram OutputName = "telegram"
-	OutputNameWebhook  OutputName = "webhook"
+	OutputNameAWeber     OutputName = "aweber"
+	OutputNameBrevo      OutputName = "brevo"
+	OutputNameConvertKit OutputName = "convertkit"
+	OutputNameDiscord    OutputName = "discord"
+	OutputNameMailchimp  OutputName = "mailchimp"
+	OutputNameMailerLite OutputName = "mailerlite"
+	OutputNameResend     OutputName = "resend"
+	OutputNameSlack      OutputName = "slack"
+	OutputNameTelegram   OutputName = "telegram"
+	OutputNameWebhook    OutputName = "webhook"
 )
 
 type ProviderName string
 
 const (
-	ProviderNameDiscord ProviderName = "Discord"
-	ProviderNameGoogle  ProviderName = "Google"
+	ProviderNameDiscord   ProviderName = "Discord"
+	ProviderNameGitHub    ProviderName = "GitHub"
+	ProviderNameGoogle    ProviderName = "Google"
+	ProviderNameMicrosoft ProviderName = "Microsoft"
+	ProviderNameReddit    ProviderName = "Reddit"
+	ProviderNameTwitch    ProviderName = "Twitch"
+)
+
+// SubscriberSourceImport is the source provider of imported subscribers that don't name one
+const SubscriberSourceImport ProviderName = "Import"
+
+type ProviderErrorStage string
+
+const (
+	ProviderErrorStageAuthorize ProviderErrorStage = "authorize"
+	ProviderErrorStageToken     ProviderErrorStage = "token"
+	ProviderErrorStageUserInfo  ProviderErrorStage = "userinfo"
+	ProviderErrorStageResult    ProviderErrorStage = "result"
+	ProviderErrorStageHandle    ProviderErrorStage = "handle"
 )
 
 var providerNames = []ProviderName{
 	ProviderNameDiscord,
+	ProviderNameGitHub,
 	ProviderNameGoogle,
+	ProviderNameMicrosoft,
+	ProviderNameReddit,
+	ProviderNameTwitch,
 }
 
 const (
-	QueryParamC     string = "c"
-	QueryParamCode  string = "code"
-	QueryParamState string = "state"
+	QueryParamC                  string = "c"
+	QueryParamCode               string = "code"
+	QueryParamCreatedAfter       string = "createdAfter"
+	QueryParamCursor             string = "cursor"
+	QueryParamCreatedBefore      string = "createdBefore"
+	QueryParamEmailListID        string = "emailListId"
+	QueryParamError              string = "error"
+	QueryParamErrorDescription   string = "error_description"
+	QueryParamFanOut             string = "fanOut"
+	QueryParamFormat             string = "format"
+	QueryParamLimit              string = "limit"
+	QueryParamOutputID           string = "outputId"
+	QueryParamQ                  string = "q"
+	QueryParamSort               string = "sort"
+	QueryParamSourceProviderName string = "sourceProviderName"
+	QueryParamState              string = "state"
+	QueryParamStatus             string = "status"
+	QueryParamSubscribers        string = "subscribers"
+)
+
+const (
+	SortKeyCreatedAt string = "createdAt"
+	SortKeyEmailAddr string = "emailAddr"
+	SortKeyName      string = "name"
+	SortKeyUpdatedAt string = "updatedAt"
 )
 
 const (
@@ -349,6 +968,39 @@ const (
 )
 
 const (
-	StrIpolEmailAddr string = "emailAddr"
-	StrIpolName      string = "name"
+	StrIpolEmailAddr  string = "emailAddr"
+	StrIpolFamilyName string = "familyName"
+	StrIpolGivenName  string = "givenName"
+	StrIpolName       string = "name"
 )
+
+const SubscriberTagUnverified string = "unverified"
+
+type WebhookEventType string
+
+const WebhookEventTypeSubscriberAdded WebhookEventType = "subscriber.added"
+
+// UnverifiedEmailPolicy decides what happens to a visitor whose OAuth provider
+// has not verified their email address.
+type UnverifiedEmailPolicy string
+
+const (
+	UnverifiedEmailPolicyAccept UnverifiedEmailPolicy = "accept"
+	UnverifiedEmailPolicyReject UnverifiedEmailPolicy = "reject"
+	UnverifiedEmailPolicyTag    UnverifiedEmailPolicy = "tag"
+)
+
+var unverifiedEmailPolicies = []UnverifiedEmailPolicy{
+	UnverifiedEmailPolicyAccept,
+	UnverifiedEmailPolicyReject,
+	UnverifiedEmailPolicyTag,
+}
+
+func validUnverifiedEmailPolicy(policy UnverifiedEmailPolicy) bool {
+	for _, p := range unverifiedEmailPolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
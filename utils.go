@@ -18,3 +18,19 @@ func fallbackIfEmpty(value string, fallback string) string {
 	}
 	return value
 }
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// truncateRunes shortens s to at most max characters, without splitting a character in two
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}